@@ -0,0 +1,126 @@
+package godep
+
+import (
+	"errors"
+	"os"
+)
+
+// ReadGodeps reads the manifest in the file path, usually
+// Godeps/Godeps.json.
+func ReadGodeps(path string) (*Godeps, error) {
+	g, err := loadGodepsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// WriteFile writes g to the file path, as save does, recording the
+// version of godep that wrote it.
+func (g *Godeps) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := g.writeTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadPackages loads the named packages, as import paths or patterns
+// relative to o.Dir, with the dependencies godep finds for them.
+func LoadPackages(o *Options, names ...string) ([]*Package, error) {
+	end, err := o.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	return loadPackages(names...)
+}
+
+// Discover returns the manifest save would write for the project in
+// o.Dir, which must already have one, without copying anything. The
+// revisions are those of the dependencies' repositories in GOPATH.
+func Discover(o *Options) (*Godeps, error) {
+	end, err := o.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	_, g, err := currentDeps(newRepoSession())
+	return g, err
+}
+
+// Save records the dependencies of pkgs, or of the package in o.Dir if
+// pkgs is empty, and copies them into the project, as godep save does.
+func Save(o *Options, pkgs []string) error {
+	end, err := o.begin()
+	if err != nil {
+		return err
+	}
+	defer end()
+	if vendorExperiment && o.Rewrite {
+		return errors.New("Rewrite is incompatible with the vendor directory")
+	}
+	defer setSaveFlags(o.Tests, o.Rewrite, o.Flatten, o.Force)()
+	return save(pkgs)
+}
+
+// Update updates the dependencies matching pkgs to the revisions in
+// their repositories in GOPATH, as godep update does.
+func Update(o *Options, pkgs []string) error {
+	end, err := o.begin()
+	if err != nil {
+		return err
+	}
+	defer end()
+	defer setSaveFlags(o.Tests, false, false, o.Force)()
+	return update(pkgs)
+}
+
+// Restore checks out the recorded revision of each dependency of the
+// project in o.Dir in GOPATH, downloading any that are missing, as
+// godep restore does.
+func Restore(o *Options) error {
+	end, err := o.begin()
+	if err != nil {
+		return err
+	}
+	defer end()
+	return restoreAll(nil)
+}
+
+// setSaveFlags sets the flags of save and update, and returns a func
+// restoring them.
+func setSaveFlags(t, r, flatten, force bool) func() {
+	ot, or, oflatten, oforce := saveT, saveR, saveFlatten, updateForce
+	saveT, saveR, saveFlatten, updateForce = t, r, flatten, force
+	return func() {
+		saveT, saveR, saveFlatten, updateForce = ot, or, oflatten, oforce
+	}
+}
+
+// Name returns the command name of the VCS, as git.
+func (v *VCS) Name() string {
+	return v.vcs.Cmd
+}
+
+// Identify returns the revision checked out in the repository holding
+// dir.
+func (v *VCS) Identify(dir string) (string, error) {
+	return v.identify(dir)
+}
+
+// Describe returns a description of rev in the repository holding dir,
+// such as the nearest tag, or "" if there is none.
+func (v *VCS) Describe(dir, rev string) string {
+	return v.describe(dir, rev)
+}
+
+// IsDirty reports whether the working tree holding dir differs from
+// rev.
+func (v *VCS) IsDirty(dir, rev string) bool {
+	return v.isDirty(dir, rev)
+}
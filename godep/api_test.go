@@ -0,0 +1,117 @@
+package godep
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	setGlobals(false)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D") + decl("D1"), nil},
+				{"+git", "D1", nil},
+			},
+		},
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main", "D"), nil},
+				{"+git", "", nil},
+			},
+		},
+	}}, "")
+	setGOPATH(filepath.Join(wd, gopath))
+	dir := filepath.Join(wd, src, "C")
+	opts := &Options{Dir: dir, GoVersion: "go1.7", Vendor: "vendor"}
+
+	log.SetOutput(ioutil.Discard)
+	err = Save(opts, nil)
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal("Save:", err)
+	}
+	if g, _ := os.Getwd(); g != wd {
+		t.Errorf("working directory = %s want %s", g, wd)
+	}
+	checkTree(t, 0, &node{src, "", []*node{
+		{"C/vendor/D/main.go", pkg("D") + decl("D1"), nil},
+	}})
+
+	g, err := ReadGodeps(filepath.Join(dir, "Godeps", "Godeps.json"))
+	if err != nil {
+		t.Fatal("ReadGodeps:", err)
+	}
+	if g.ImportPath != "C" || len(g.Deps) != 1 || g.Deps[0].ImportPath != "D" || g.Deps[0].Comment != "D1" {
+		t.Errorf("ReadGodeps = %+v", g)
+	}
+
+	d, err := Discover(opts)
+	if err != nil {
+		t.Fatal("Discover:", err)
+	}
+	if len(d.Deps) != 1 || d.Deps[0].Rev != g.Deps[0].Rev {
+		t.Errorf("Discover deps = %+v want %+v", d.Deps, g.Deps)
+	}
+
+	ps, err := LoadPackages(opts, ".")
+	if err != nil {
+		t.Fatal("LoadPackages:", err)
+	}
+	if len(ps) != 1 || ps[0].ImportPath != "C" {
+		t.Errorf("LoadPackages = %+v", ps)
+	}
+	// Local import paths are relative to o.Dir.
+	ps, err = LoadPackages(opts, "./...")
+	if err != nil {
+		t.Fatal("LoadPackages:", err)
+	}
+	if len(ps) != 2 || ps[0].ImportPath != "C" || ps[1].ImportPath != "C/vendor/D" {
+		t.Errorf("LoadPackages ./... = %+v", ps)
+	}
+
+	makeTree(t, &node{src, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D") + decl("D2"), nil},
+				{"+git", "D2", nil},
+			},
+		},
+	}}, "")
+	log.SetOutput(ioutil.Discard)
+	err = Update(opts, []string{"D"})
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal("Update:", err)
+	}
+	checkTree(t, 0, &node{src, "", []*node{
+		{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+	}})
+	if _, err := os.Stat("Godeps"); !os.IsNotExist(err) {
+		t.Error("Godeps made in the working directory")
+	}
+
+	if err := Save(&Options{Dir: dir, Vendor: "elsewhere"}, nil); err == nil {
+		t.Error("Save with a bad Vendor setting succeeded")
+	}
+}
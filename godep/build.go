@@ -0,0 +1,196 @@
+package godep
+
+import (
+	"flag"
+	"go/build"
+	"sort"
+	"strings"
+)
+
+// buildTarget is a GOOS/GOARCH pair dependencies are discovered for.
+// The zero buildTarget matches every platform.
+type buildTarget struct {
+	goos, goarch string
+}
+
+func (t buildTarget) String() string {
+	if t.goos == "" {
+		return ""
+	}
+	return t.goos + "/" + t.goarch
+}
+
+var (
+	defaultIgnoreTags = []string{"appengine", "ignore"} //TODO: appengine is a special case for now: https://github.com/tools/godep/issues/353
+
+	// buildTags are tags taken to be set when scanning,
+	// buildTargets the platforms to scan for. Both are set by
+	// setBuildConfig.
+	buildTags    []string
+	buildTargets []buildTarget
+
+	// Flag values shared by save, update and diff. A flag that is
+	// given replaces the matching list in Godeps.json.
+	flagTags, flagIgnoreTags, flagTargets string
+
+	// srcFiles holds the non-test Go files of each filled package,
+	// so imports can be worked out per target.
+	srcFiles = make(map[string][]srcFile) // dir => files
+)
+
+// srcFile is what the scanner keeps of a Go file.
+type srcFile struct {
+	name    string
+	imports []string
+	cons    constraint // nil if the file has no build constraint
+}
+
+const (
+	knownOS   = "aix android darwin dragonfly freebsd hurd illumos ios js linux nacl netbsd openbsd plan9 solaris wasip1 windows zos"
+	knownArch = "386 amd64 amd64p32 arm armbe arm64 arm64be loong64 mips mipsle mips64 mips64le mips64p32 mips64p32le ppc ppc64 ppc64le riscv riscv64 s390 s390x sparc sparc64 wasm"
+	unixOS    = "aix android darwin dragonfly freebsd hurd illumos ios linux netbsd openbsd solaris"
+)
+
+func isKnown(list, name string) bool {
+	for _, s := range strings.Fields(list) {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func addBuildFlags(f *flag.FlagSet) {
+	f.StringVar(&flagTags, "tags", "", "space-separated build tags to take as set when scanning")
+	f.StringVar(&flagIgnoreTags, "ignoretags", "", "space-separated build tags to take as unset when scanning, in addition to appengine and ignore")
+	f.StringVar(&flagTargets, "targets", "", "space-separated GOOS/GOARCH pairs to discover dependencies for")
+}
+
+// setBuildConfig applies any build flags to g and configures the
+// scanner from the result.
+func setBuildConfig(g *Godeps) error {
+	if flagTags != "" {
+		g.Tags = strings.Fields(flagTags)
+	}
+	if flagIgnoreTags != "" {
+		g.IgnoreTags = strings.Fields(flagIgnoreTags)
+	}
+	if flagTargets != "" {
+		g.Targets = strings.Fields(flagTargets)
+	}
+	targets, err := parseTargets(g.Targets)
+	if err != nil {
+		return err
+	}
+	flattenVendor = g.Flatten
+	projectFiles = fileRules{include: g.Include, exclude: g.Exclude}
+	buildTags = g.Tags
+	buildTargets = targets
+	ignoreTags = nil
+	for _, tag := range append(defaultIgnoreTags, g.IgnoreTags...) {
+		if !containsString(g.Tags, tag) {
+			ignoreTags = append(ignoreTags, tag)
+		}
+	}
+	debugln("tags", buildTags, "ignoreTags", ignoreTags, "targets", buildTargets)
+	return nil
+}
+
+func parseTargets(a []string) ([]buildTarget, error) {
+	var targets []buildTarget
+	for _, s := range a {
+		i := strings.Index(s, "/")
+		if i < 0 || !isKnown(knownOS, s[:i]) || !isKnown(knownArch, s[i+1:]) {
+			return nil, errBadTarget(s)
+		}
+		targets = append(targets, buildTarget{goos: s[:i], goarch: s[i+1:]})
+	}
+	return targets, nil
+}
+
+// scanTargets returns the targets to scan for, or the zero target
+// if none are configured.
+func scanTargets() []buildTarget {
+	if len(buildTargets) == 0 {
+		return []buildTarget{{}}
+	}
+	return buildTargets
+}
+
+// imports returns the imports of the files in p that build for t.
+func (t buildTarget) imports(p *build.Package) []string {
+	files, ok := srcFiles[p.Dir]
+	if t.goos == "" || !ok {
+		return p.Imports
+	}
+	var imports []string
+	for _, f := range files {
+		if t.matchFile(f) {
+			imports = append(imports, f.imports...)
+		}
+	}
+	return uniq(imports)
+}
+
+func (t buildTarget) matchFile(f srcFile) bool {
+	return t.matchFileName(f.name) && (f.cons == nil || t.satisfiable(f.cons))
+}
+
+// matchFileName reports whether the _GOOS, _GOARCH or _GOOS_GOARCH
+// suffix of name, if any, matches t.
+// $GOROOT/src/go/build/build.go goodOSArchFile
+func (t buildTarget) matchFileName(name string) bool {
+	name = strings.TrimSuffix(name, ".go")
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return true
+	}
+	l := strings.Split(name[i:], "_")
+	if n := len(l); n > 0 && l[n-1] == "test" {
+		l = l[:n-1]
+	}
+	n := len(l)
+	if n >= 2 && isKnown(knownOS, l[n-2]) && isKnown(knownArch, l[n-1]) {
+		return t.matchTag(l[n-2]) && t.matchTag(l[n-1])
+	}
+	if n >= 1 && (isKnown(knownOS, l[n-1]) || isKnown(knownArch, l[n-1])) {
+		return t.matchTag(l[n-1])
+	}
+	return true
+}
+
+// matchTag reports whether the GOOS, GOARCH or unix tag name holds for t.
+func (t buildTarget) matchTag(name string) bool {
+	switch name {
+	case t.goos, t.goarch:
+		return true
+	case "unix":
+		return isKnown(unixOS, t.goos)
+	case "linux":
+		return t.goos == "android"
+	case "solaris":
+		return t.goos == "illumos"
+	case "darwin":
+		return t.goos == "ios"
+	}
+	return false
+}
+
+// targetNames returns the sorted, unique names of targets.
+func targetNames(targets []string) []string {
+	if len(targets) == 0 {
+		return nil
+	}
+	a := append([]string(nil), targets...)
+	sort.Strings(a)
+	return uniq(a)
+}
+
+func containsString(a []string, s string) bool {
+	for _, t := range a {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package godep
+
+import "testing"
+
+func TestBuildTargetMatch(t *testing.T) {
+	linux := buildTarget{"linux", "amd64"}
+	android := buildTarget{"android", "arm"}
+	windows := buildTarget{"windows", "386"}
+	var cases = []struct {
+		t     buildTarget
+		name  string
+		build []string
+		want  bool
+	}{
+		{linux, "a.go", nil, true},
+		{linux, "a_linux.go", nil, true},
+		{windows, "a_linux.go", nil, false},
+		{android, "a_linux.go", nil, true},
+		{linux, "a_amd64.go", nil, true},
+		{windows, "a_amd64.go", nil, false},
+		{linux, "a_linux_386.go", nil, false},
+		{windows, "a_windows_386_test.go", nil, true},
+		{linux, "linux.go", nil, true}, // no suffix before the name
+		{linux, "a_foo.go", nil, true},
+		{linux, "a.go", []string{"linux darwin"}, true},
+		{windows, "a.go", []string{"linux darwin"}, false},
+		{windows, "a.go", []string{"!windows"}, false},
+		{linux, "a.go", []string{"unix"}, true},
+		{windows, "a.go", []string{"unix"}, false},
+		{linux, "a.go", []string{"linux,386 darwin"}, false},
+		{linux, "a.go", []string{"linux,cgo"}, true}, // cgo is left to the tag lists
+		{linux, "a.go", []string{"linux", "!amd64"}, false},
+	}
+	for pos, test := range cases {
+		var lines []string
+		for _, l := range test.build {
+			lines = append(lines, "+build "+l)
+		}
+		cons, err := headerConstraint(lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := srcFile{name: test.name, cons: cons}
+		if g := test.t.matchFile(f); g != test.want {
+			t.Errorf("%d %v.matchFile(%s %q) = %v want %v", pos, test.t, test.name, test.build, g, test.want)
+		}
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	ts, err := parseTargets([]string{"linux/amd64", "windows/386"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 2 || ts[0] != (buildTarget{"linux", "amd64"}) || ts[1].String() != "windows/386" {
+		t.Errorf("parseTargets = %v", ts)
+	}
+	for _, s := range []string{"linux", "linux/", "plan10/amd64", "linux/z80"} {
+		if _, err := parseTargets([]string{s}); err == nil {
+			t.Errorf("parseTargets(%q) err = nil", s)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package godep
+
+import (
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var cmdCheck = &Command{
+	Name:  "check",
+	Args:  "",
+	Short: "check that the manifest and copied source are consistent",
+	Long: `
+Check reports, without changing anything, each way in which the
+project, Godeps.json and the copied source disagree:
+
+	missing     an import of a package outside the standard library
+	            that is not in Godeps.json or not copied
+	unused      a dependency in Godeps.json no project package imports
+	unlisted    a copied package that is not in Godeps.json
+	rev         packages from the same repository at different revisions
+	goversion   a GoVersion other than that of the go command
+	workspace   a Godeps/_workspace, which is deprecated
+
+Packages are found as for save, using the packages and settings
+recorded in Godeps.json.
+
+Findings are printed grouped by the names above, one per line. With
+-json, they are instead the Data of a single result event with Action
+check: a JSON array of groups, each with the name of the check and its
+findings. Check exits with status 1 if there are any findings.
+`,
+	Run:          runCheck,
+	OnlyInGOPATH: true,
+}
+
+// The checks, in the order they are reported.
+var checkNames = []string{"missing", "unused", "unlisted", "rev", "goversion", "workspace"}
+
+// CheckGroup is the findings of one check.
+type CheckGroup struct {
+	Check    string
+	Findings []CheckFinding
+}
+
+// CheckFinding is one problem found by check.
+type CheckFinding struct {
+	ImportPath string `json:",omitempty"`
+	Package    string `json:",omitempty"` // the importing package, if any
+	Detail     string
+}
+
+func runCheck(cmd *Command, args []string) {
+	if len(args) != 0 {
+		cmd.UsageExit()
+	}
+	groups, err := check()
+	if err != nil {
+		fatal(err)
+	}
+	reportCheck(groups)
+	if len(groups) > 0 {
+		exit(1)
+	}
+}
+
+// reportCheck prints groups, or with -json reports them as the Data of
+// one result event.
+func reportCheck(groups []CheckGroup) {
+	if events != nil {
+		if groups == nil {
+			groups = []CheckGroup{} // [], not null
+		}
+		result("check", "", "", groups)
+		return
+	}
+	writeCheck(stdout, groups)
+}
+
+func writeCheck(w io.Writer, groups []CheckGroup) {
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s:\n", g.Check)
+		for _, f := range g.Findings {
+			fmt.Fprint(w, "\t")
+			if f.Package != "" {
+				fmt.Fprintf(w, "%s imports ", f.Package)
+			}
+			if f.ImportPath != "" {
+				fmt.Fprintf(w, "%s: ", f.ImportPath)
+			}
+			fmt.Fprintln(w, f.Detail)
+		}
+	}
+}
+
+// check runs every check and returns the groups with findings.
+func check() ([]CheckGroup, error) {
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return nil, err
+	}
+	ignoreImports = g.Ignore
+	if err := setBuildConfig(&g); err != nil {
+		return nil, err
+	}
+	found := make(map[string][]CheckFinding)
+	add := func(check string, f CheckFinding) {
+		found[check] = append(found[check], f)
+	}
+	inManifest := make(map[string]bool)
+	for _, d := range g.Deps {
+		inManifest[d.ImportPath] = true
+	}
+	vendorDir := relativeVendorTarget(vendorExperiment)
+
+	// missing and unused
+	used, err := checkImports(&g, func(pkg, path, detail string) {
+		add("missing", CheckFinding{ImportPath: path, Package: pkg, Detail: detail})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range g.Deps {
+		if !used[d.ImportPath] {
+			add("unused", CheckFinding{ImportPath: d.ImportPath, Detail: "not imported by the project"})
+		}
+	}
+
+	// unlisted
+	err = filepath.Walk(vendorDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == vendorDir {
+				return nil
+			}
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		name := fi.Name()
+		if path != vendorDir && (name[0] == '.' || name[0] == '_' || name == "testdata" || name == "vendor") {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(vendorDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		ip := filepath.ToSlash(rel)
+		if !inManifest[ip] && hasGoFiles(path) {
+			add("unlisted", CheckFinding{ImportPath: ip, Detail: "copied but not in " + g.file()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// rev
+	for _, f := range revMismatches(g.Deps) {
+		add("rev", f)
+	}
+
+	// goversion
+	if g.GoVersion != "" {
+		want, err := trimGoVersion(g.GoVersion)
+		if err != nil {
+			add("goversion", CheckFinding{Detail: err.Error()})
+		} else if want != majorGoVersion {
+			add("goversion", CheckFinding{Detail: g.file() + " has " + want + ", but go is " + majorGoVersion})
+		}
+	}
+
+	// workspace
+	ws := filepath.Join("Godeps", "_workspace")
+	if fi, err := os.Stat(ws); err == nil && fi.IsDir() {
+		add("workspace", CheckFinding{Detail: ws + " is deprecated; remove it and run 'godep save' to use vendor/"})
+	}
+
+	var groups []CheckGroup
+	for _, name := range checkNames {
+		if len(found[name]) > 0 {
+			groups = append(groups, CheckGroup{Check: name, Findings: found[name]})
+		}
+	}
+	return groups, nil
+}
+
+// checkImports calls missing for each import by the project, or by a
+// package it imports, of a package outside the standard library that is
+// not in g or not copied, and returns the import paths of the
+// dependencies it found.
+func checkImports(g *Godeps, missing func(pkg, path, detail string)) (map[string]bool, error) {
+	args := g.Packages
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []*Package
+	load := func(importer, path string) error {
+		p, err := listPackage(path)
+		if e, ok := err.(errPackageNotFound); ok {
+			missing(importer, unqualify(e.path), "not found")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		pkgs = append(pkgs, p)
+		return nil
+	}
+	for _, path := range importPaths(args) {
+		if err := load("", path); err != nil {
+			return nil, err
+		}
+	}
+	// Test imports of the project's packages, and what they import.
+	// They are loaded by directory, so copies in vendor/ are found.
+	for _, p := range pkgs {
+		for _, ti := range append(append([]string(nil), p.TestImports...), p.XTestImports...) {
+			if isIgnored(ti) {
+				continue
+			}
+			bp, err := build.Import(ti, p.Dir, build.FindOnly)
+			if err != nil {
+				missing(p.ImportPath, ti, "not found")
+				continue
+			}
+			if bp.Goroot || isProjectPath(g, bp.ImportPath) {
+				continue
+			}
+			rel, err := filepath.Rel(cwd, bp.Dir)
+			if err != nil {
+				return nil, err
+			}
+			if err := load(p.ImportPath, "./"+filepath.ToSlash(rel)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	used := make(map[string]bool)
+	vendorDir := relativeVendorTarget(vendorExperiment)
+	seen := make(map[string]bool)
+	for _, p := range pkgs {
+		deps := p.Dependencies
+		if !isProjectPath(g, p.ImportPath) {
+			// A package reached by a test import is itself a dependency.
+			deps = append(deps, build.Package{ImportPath: p.ImportPath, Dir: p.Dir, Goroot: p.Standard})
+		}
+		for _, dp := range deps {
+			if dp.Goroot || seen[dp.ImportPath] {
+				continue
+			}
+			seen[dp.ImportPath] = true
+			ip := unqualify(dp.ImportPath)
+			if isProjectPath(g, dp.ImportPath) {
+				continue // part of the project
+			}
+			if strings.Count(dp.ImportPath, sep) > 1 {
+				continue // in the copy of another dependency
+			}
+			used[ip] = true
+			var inManifest bool
+			for _, d := range g.Deps {
+				if d.ImportPath == ip {
+					inManifest = true
+				}
+			}
+			switch {
+			case !inManifest:
+				missing(p.ImportPath, ip, "not in "+g.file())
+			case !hasGoFiles(filepath.Join(vendorDir, filepath.FromSlash(ip))):
+				missing(p.ImportPath, ip, "not copied to "+filepath.ToSlash(vendorDir))
+			}
+		}
+	}
+	return used, nil
+}
+
+// revMismatches returns a finding for each pair of deps from the same
+// repository at different revisions.
+func revMismatches(deps []Dependency) []CheckFinding {
+	var found []CheckFinding
+	for i, a := range deps {
+		for _, b := range deps[i+1:] {
+			same := containsPathPrefix([]string{a.ImportPath}, b.ImportPath) ||
+				containsPathPrefix([]string{b.ImportPath}, a.ImportPath)
+			if r := guessRepoRoot(a.ImportPath); r != "" && r == guessRepoRoot(b.ImportPath) {
+				same = true
+			}
+			if same && a.Rev != b.Rev {
+				found = append(found, CheckFinding{
+					ImportPath: b.ImportPath,
+					Detail:     fmt.Sprintf("at %s, but %s is at %s", shortRev(b.Rev), a.ImportPath, shortRev(a.Rev)),
+				})
+			}
+		}
+	}
+	return found
+}
+
+// guessRepoRoot returns the repository root of importPath, if it is
+// on a host whose layout is known, or "".
+func guessRepoRoot(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	n := 0
+	switch elems[0] {
+	case "github.com", "bitbucket.org", "gitlab.com", "golang.org":
+		n = 3
+	case "google.golang.org", "cloud.google.com":
+		n = 2
+	case "gopkg.in":
+		n = 2
+		if len(elems) > 2 && !strings.Contains(elems[1], ".") {
+			n = 3 // gopkg.in/user/pkg.v1
+		}
+	}
+	if n == 0 || len(elems) < n {
+		return ""
+	}
+	return strings.Join(elems[:n], "/")
+}
+
+func hasGoFiles(dir string) bool {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	return err == nil && len(names) > 0
+}
+
+// isProjectPath reports whether importPath is of a package of the
+// project rather than a copy of a dependency.
+func isProjectPath(g *Godeps, importPath string) bool {
+	return unqualify(importPath) == importPath && containsPathPrefix([]string{g.ImportPath}, importPath)
+}
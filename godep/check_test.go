@@ -0,0 +1,244 @@
+package godep
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	var cases = []struct {
+		vendor bool
+		start  []*node
+		want   map[string][]string // check => import paths found
+	}{
+		{ // 0 - consistent
+			vendor: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"T",
+					"",
+					[]*node{
+						{"main.go", pkg("T"), nil},
+						{"+git", "T1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"main_test.go", pkg("main", "T"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1", "T", "T1"), nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"vendor/T/main.go", pkg("T"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+		},
+		{ // 1 - missing from the manifest, and not copied
+			vendor: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: map[string][]string{"missing": {"D", "E"}},
+		},
+		{ // 2 - unused and unlisted
+			vendor: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1", "E", "E1"), nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"vendor/E/main.go", pkg("E"), nil},
+						{"vendor/F/main.go", pkg("F"), nil},
+						{"vendor/F/.hidden/x.go", pkg("x"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: map[string][]string{"unused": {"E"}, "unlisted": {"F"}},
+		},
+		{ // 3 - packages of one repository at different revisions
+			vendor: true,
+			start: []*node{
+				{
+					"github.com/x/y",
+					"",
+					[]*node{
+						{"a/main.go", pkg("a"), nil},
+						{"b/main.go", pkg("b"), nil},
+						{"+git", "Y1", nil},
+						{"b/main.go", pkg("b") + decl("B2"), nil},
+						{"+git", "Y2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "github.com/x/y/a", "github.com/x/y/b"), nil},
+						{"Godeps/Godeps.json", godeps("C", "github.com/x/y/a", "Y1", "github.com/x/y/b", "Y2"), nil},
+						{"vendor/github.com/x/y/a/main.go", pkg("a"), nil},
+						{"vendor/github.com/x/y/b/main.go", pkg("b") + decl("B2"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: map[string][]string{"rev": {"github.com/x/y/b"}},
+		},
+		{ // 4 - Godeps workspace, used as the copy
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: map[string][]string{"workspace": {""}},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		setGlobals(test.vendor)
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		setGOPATH(filepath.Join(wd, gopath))
+		log.SetOutput(ioutil.Discard)
+		groups, err := check()
+		log.SetOutput(os.Stderr)
+		if err != nil {
+			t.Errorf("%d check: %v", pos, err)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		got := make(map[string][]string)
+		for _, g := range groups {
+			for _, f := range g.Findings {
+				got[g.Check] = append(got[g.Check], f.ImportPath)
+			}
+		}
+		want := test.want
+		if want == nil {
+			want = map[string][]string{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d findings = %v want %v", pos, groups, want)
+		}
+	}
+}
+
+func TestReportCheckJSON(t *testing.T) {
+	groups := []CheckGroup{
+		{Check: "missing", Findings: []CheckFinding{{ImportPath: "D", Package: "C", Detail: "not copied"}}},
+		{Check: "workspace", Findings: []CheckFinding{{Detail: "Godeps/_workspace exists"}}},
+	}
+	for _, g := range [][]CheckGroup{nil, groups} {
+		var buf bytes.Buffer
+		end := startEvents(&buf, "check")
+		reportCheck(g)
+		end()
+		var e struct {
+			Type, Action string
+			Data         *[]CheckGroup
+		}
+		if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+			t.Fatalf("%v: %s", err, buf.Bytes())
+		}
+		want := g
+		if want == nil {
+			want = []CheckGroup{}
+		}
+		if e.Type != "result" || e.Action != "check" || e.Data == nil || !reflect.DeepEqual(*e.Data, want) {
+			t.Errorf("reportCheck(%v) = %s", g, buf.Bytes())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package godep
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	verbose          bool // Verbose flag for commands that support it
+	debug            bool // Debug flag for commands that support it
+	majorGoVersion   string
+	vendorExperiment bool
+	sep              string
+)
+
+// Command is an implementation of a godep command
+// like godep save or godep go.
+type Command struct {
+	// Run runs the command.
+	// The args are the arguments after the command name.
+	Run func(cmd *Command, args []string)
+
+	// Name of the command
+	Name string
+
+	// Args the command would expect
+	Args string
+
+	// Short is the short description shown in the 'godep help' output.
+	Short string
+
+	// Long is the long message shown in the
+	// 'godep help <this-command>' output.
+	Long string
+
+	// Flag is a set of flags specific to this command.
+	Flag flag.FlagSet
+
+	// OnlyInGOPATH limits this command to being run only while inside of a GOPATH
+	OnlyInGOPATH bool
+}
+
+// UsageExit prints usage information and exits.
+func (c *Command) UsageExit() {
+	if events != nil {
+		events.emit(Event{Type: "error", Code: "usage", Message: fmt.Sprintf("Args: godep %s [-v] [-d] %s", c.Name, c.Args)})
+		exit(2)
+	}
+	fmt.Fprintf(os.Stderr, "Args: godep %s [-v] [-d] %s\n\n", c.Name, c.Args)
+	fmt.Fprintf(os.Stderr, "Run 'godep help %s' for help.\n", c.Name)
+	os.Exit(2)
+}
+
+// Exec runs c with the settings in o, with o.Dir as the working
+// directory. The args are the arguments left after parsing c.Flag.
+// Like Run, Exec may exit the process.
+func (c *Command) Exec(o *Options, args []string) {
+	if o.JSON {
+		defer startEvents(os.Stdout, c.Name)()
+	}
+	defer handleSignals()()
+	if o.Dir != "" {
+		// Commands find the project's files from the working
+		// directory, as when run by godep itself.
+		wd, err := os.Getwd()
+		if err != nil {
+			fatal(err)
+		}
+		if err := os.Chdir(o.Dir); err != nil {
+			fatal(err)
+		}
+		defer os.Chdir(wd)
+		co := *o
+		co.Dir = ""
+		o = &co
+	}
+	if c.OnlyInGOPATH {
+		checkInGOPATH()
+	}
+	end, err := o.begin()
+	if err != nil {
+		fatal(err)
+	}
+	defer end()
+
+	debugln("versionString()", versionString())
+	debugln("majorGoVersion", majorGoVersion)
+	debugln("vendorExperiment", vendorExperiment)
+	debugln("sep", sep)
+	debugln("gitLib", o.GitLib)
+
+	c.Run(c, args)
+	if events != nil {
+		events.summary(0)
+	}
+}
+
+// Commands lists the available commands and help topics.
+// The order here is the order in which they are printed
+// by 'godep help'.
+var Commands = []*Command{
+	cmdSave,
+	cmdGo,
+	cmdGet,
+	cmdPath,
+	cmdRestore,
+	cmdUpdate,
+	cmdDiff,
+	cmdCheck,
+	cmdVendorStatus,
+	cmdExport,
+	cmdUnrewrite,
+	cmdMv,
+	cmdPatch,
+	cmdHold,
+	cmdUnhold,
+	cmdApply,
+	cmdConfig,
+	cmdVersion,
+}
+
+// vendorExperiment is the Go 1.5 vendor directory experiment flag, see
+// https://github.com/golang/go/commit/183cc0cd41f06f83cb7a2490a499e3f9101befff
+// Honor the env var unless the project already has an old school godep workspace
+func determineVendor(v string) bool {
+	go15ve := os.Getenv("GO15VENDOREXPERIMENT")
+	var ev bool
+	switch v {
+	case "go1", "go1.1", "go1.2", "go1.3", "go1.4":
+		ev = false
+	case "go1.5":
+		ev = go15ve == "1"
+	case "go1.6":
+		ev = go15ve != "0"
+	default: //go1.7+, devel*
+		ev = true
+	}
+
+	ws := filepath.Join("Godeps", "_workspace")
+	s, err := os.Stat(inProject(ws))
+	if err == nil && s.IsDir() {
+		log.Printf("WARNING: Godep workspaces (./Godeps/_workspace) are deprecated and support for them will be removed when go1.8 is released.")
+		if ev {
+			log.Printf("WARNING: Go version (%s) & $GO15VENDOREXPERIMENT=%s wants to enable the vendor experiment, but disabling because a Godep workspace (%s) exists\n", v, go15ve, ws)
+		}
+		return false
+	}
+
+	return ev
+}
+
+func subPath(sub, path string) bool {
+	ls := strings.ToLower(sub)
+	lp := strings.ToLower(path)
+	if ls == lp {
+		return false
+	}
+	return strings.HasPrefix(ls, lp)
+}
+
+func checkInGOPATH() {
+	pwd, err := os.Getwd()
+	if err != nil {
+		fatal("Unable to determine current working directory", err)
+	}
+	dirs := build.Default.SrcDirs()
+	for _, p := range dirs {
+		if ok := subPath(pwd, p); ok {
+			return
+		}
+	}
+
+	log.Println("[WARNING]: godep should only be used inside a valid go package directory and")
+	log.Println("[WARNING]: may not function correctly. You are probably outside of your $GOPATH.")
+	log.Printf("[WARNING]:\tCurrent Directory: %s\n", pwd)
+	log.Printf("[WARNING]:\t$GOPATH: %s\n", os.Getenv("GOPATH"))
+}
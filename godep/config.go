@@ -0,0 +1,304 @@
+package godep
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var cmdConfig = &Command{
+	Name:  "config",
+	Args:  "[command...]",
+	Short: "show the effective project configuration",
+	Long: `
+Config prints the project's policies from Godeps/config.json and the
+flag defaults in effect for each command, with where each comes from.
+
+Godeps/config.json holds settings shared by everyone working on the
+project, as a JSON object:
+
+	{
+		"Flags": {
+			"*": {"v": "true"},
+			"save": {"t": "true", "tags": "integration"},
+			"update": {"t": "true"}
+		},
+		"AllowedHosts": ["github.com", "*.example.com"],
+		"Ignore": ["example.com/internal/tools/..."],
+		"Vendor": "vendor"
+	}
+
+Flags sets the default value of flags by command name; the flags for
+"*" apply to every command that has them. A flag is taken, in order of
+precedence, from the command line, then from $GODEPFLAGS, a space
+separated list of flags such as "-t -tags=integration" applied to every
+command that has them, then from Flags, then from the flag's own
+default.
+
+AllowedHosts lists the hosts dependencies may come from, as patterns
+for path.Match; save and update fail on any other dependency. Ignore
+lists import path patterns never to vendor, in addition to the Ignore
+list of Godeps.json. Vendor is the layout dependencies are copied to,
+"vendor" or "workspace", in place of the one picked from the Go
+version.
+
+With no arguments, config lists only the flags set by the file or the
+environment. Given commands, it lists every flag of each.
+`,
+}
+
+func init() {
+	cmdConfig.Run = runConfig // runConfig refers to Commands
+}
+
+// configFile is the project configuration file.
+var configFile = filepath.Join("Godeps", "config.json")
+
+// Config is the project configuration, kept in Godeps/config.json.
+type Config struct {
+	// Flags holds default flag values by command name, as they
+	// would be given on the command line. The name "*" applies to
+	// every command with the flag.
+	Flags map[string]map[string]string `json:",omitempty"`
+
+	AllowedHosts []string `json:",omitempty"` // Host patterns dependencies may come from; empty is any.
+	Ignore       []string `json:",omitempty"` // Import path patterns never to vendor.
+	Vendor       string   `json:",omitempty"` // "vendor", "workspace", or "" for the Go version's default.
+}
+
+// projectConfig is the configuration of the project the current call
+// runs in, set by Options.begin.
+var projectConfig = &Config{}
+
+// ReadConfig reads the project configuration in the file path. A
+// missing file is an empty configuration.
+func ReadConfig(path string) (*Config, error) {
+	c := &Config{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(c); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %s", path, err.Error())
+	}
+	switch c.Vendor {
+	case "", "vendor", "workspace":
+	default:
+		return nil, fmt.Errorf("%s: unknown Vendor setting %q", path, c.Vendor)
+	}
+	return c, nil
+}
+
+// AddFlags defines the flags of o that every command takes in fs.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Verbose, "v", false, "enable verbose output")
+	fs.BoolVar(&o.Debug, "d", false, "enable debug output")
+	fs.BoolVar(&o.GitLib, "gitlib", false, "read git repositories directly instead of running git")
+	fs.BoolVar(&o.JSON, "json", false, "write the output as newline-delimited JSON events")
+}
+
+// Parse parses the command line args of c. Each flag is first set from
+// Godeps/config.json in the current directory, then from $GODEPFLAGS,
+// so the command line overrides the environment, which overrides the
+// file.
+func (c *Command) Parse(args []string) error {
+	cfg, err := ReadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	set, err := flagSettings(cfg, c.Name, &c.Flag)
+	if err != nil {
+		return err
+	}
+	for _, s := range set {
+		if err := c.Flag.Set(s.Name, s.Value); err != nil {
+			return fmt.Errorf("%s: -%s: %s", s.Source, s.Name, err)
+		}
+	}
+	return c.Flag.Parse(args)
+}
+
+// A FlagSetting is the value of a flag of a command and where it came
+// from: "default", the config file, or "GODEPFLAGS".
+type FlagSetting struct {
+	Command string
+	Name    string
+	Value   string
+	Source  string
+}
+
+// flagSettings returns the flags of the command named cmd, defined in
+// fs, that cfg or $GODEPFLAGS set, in the order they are to be applied.
+func flagSettings(cfg *Config, cmd string, fs *flag.FlagSet) ([]FlagSetting, error) {
+	var set []FlagSetting
+	for _, name := range []string{"*", cmd} {
+		var names []string
+		for n := range cfg.Flags[name] {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			if fs.Lookup(n) == nil {
+				if name == "*" {
+					continue
+				}
+				return nil, fmt.Errorf("%s: %s has no flag -%s", configFile, cmd, n)
+			}
+			set = append(set, FlagSetting{cmd, n, cfg.Flags[name][n], configFile})
+		}
+	}
+	for _, arg := range strings.Fields(os.Getenv("GODEPFLAGS")) {
+		n := strings.TrimLeft(arg, "-")
+		if n == arg || n == "" {
+			return nil, fmt.Errorf("GODEPFLAGS: %q is not a flag", arg)
+		}
+		v := "true"
+		if i := strings.Index(n, "="); i >= 0 {
+			n, v = n[:i], n[i+1:]
+		}
+		f := fs.Lookup(n)
+		if f == nil {
+			continue // like GOFLAGS, for the commands that have it
+		}
+		if b, ok := f.Value.(interface {
+			IsBoolFlag() bool
+		}); (!ok || !b.IsBoolFlag()) && !strings.Contains(arg, "=") {
+			return nil, fmt.Errorf("GODEPFLAGS: -%s needs a value, as -%s=value", n, n)
+		}
+		set = append(set, FlagSetting{cmd, n, v, "GODEPFLAGS"})
+	}
+	return set, nil
+}
+
+// errHostNotAllowed is a dependency from a host not in AllowedHosts.
+type errHostNotAllowed string
+
+func (e errHostNotAllowed) Error() string {
+	return "dependency " + string(e) + " is not from a host in AllowedHosts of " + configFile
+}
+
+func (e errHostNotAllowed) code() string { return "host-not-allowed" }
+
+// checkHosts returns an error for the first of deps not from a host in
+// the project's AllowedHosts.
+func checkHosts(deps []Dependency) error {
+	if len(projectConfig.AllowedHosts) == 0 {
+		return nil
+	}
+	for _, d := range deps {
+		if !hostAllowed(d.ImportPath) {
+			return errHostNotAllowed(d.ImportPath)
+		}
+	}
+	return nil
+}
+
+func hostAllowed(importPath string) bool {
+	host := importPath
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	for _, pat := range projectConfig.AllowedHosts {
+		if ok, _ := path.Match(pat, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func runConfig(cmd *Command, args []string) {
+	cmds := Commands
+	if len(args) > 0 {
+		cmds = nil
+		for _, name := range args {
+			c := findCommand(name)
+			if c == nil {
+				fatalf("unknown command %q", name)
+			}
+			cmds = append(cmds, c)
+		}
+	}
+	settings, err := effectiveFlags(cmds, len(args) > 0)
+	if err != nil {
+		fatal(err)
+	}
+	if events != nil {
+		result("policy", "", "", projectConfig)
+		for _, s := range settings {
+			result("flag", "", "", s)
+		}
+		return
+	}
+	writeConfig(stdout, projectConfig, settings)
+}
+
+func findCommand(name string) *Command {
+	for _, c := range Commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// effectiveFlags returns the value of each flag of cmds, with the flags
+// every command takes, as Parse would set it with no command line
+// flags. Unless all is set, only flags set by the config file or the
+// environment are returned.
+func effectiveFlags(cmds []*Command, all bool) ([]FlagSetting, error) {
+	var a []FlagSetting
+	for _, c := range cmds {
+		var fs flag.FlagSet
+		var o Options
+		o.AddFlags(&fs)
+		c.Flag.VisitAll(func(f *flag.Flag) {
+			if fs.Lookup(f.Name) == nil { // the running command has them already
+				fs.Var(f.Value, f.Name, f.Usage)
+			}
+		})
+		set, err := flagSettings(projectConfig, c.Name, &fs)
+		if err != nil {
+			return nil, err
+		}
+		// Later settings override earlier ones, as in Parse.
+		source := make(map[string]FlagSetting)
+		for _, s := range set {
+			source[s.Name] = s
+		}
+		fs.VisitAll(func(f *flag.Flag) {
+			if s, ok := source[f.Name]; ok {
+				a = append(a, s)
+			} else if all {
+				a = append(a, FlagSetting{c.Name, f.Name, f.DefValue, "default"})
+			}
+		})
+	}
+	return a, nil
+}
+
+func writeConfig(w io.Writer, cfg *Config, settings []FlagSetting) {
+	vendor := cfg.Vendor
+	if vendor == "" {
+		vendor = "(from the Go version)"
+	}
+	fmt.Fprintln(w, "Vendor:", vendor)
+	if len(cfg.AllowedHosts) > 0 {
+		fmt.Fprintln(w, "AllowedHosts:", strings.Join(cfg.AllowedHosts, " "))
+	}
+	if len(cfg.Ignore) > 0 {
+		fmt.Fprintln(w, "Ignore:", strings.Join(cfg.Ignore, " "))
+	}
+	for _, s := range settings {
+		fmt.Fprintf(w, "%s -%s=%s\t(%s)\n", s.Command, s.Name, s.Value, s.Source)
+	}
+}
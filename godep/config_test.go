@@ -0,0 +1,119 @@
+package godep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCommandParse(t *testing.T) {
+	var cases = []struct {
+		config string
+		env    string
+		args   []string
+		want   map[string]string // flag => value
+		werr   bool
+	}{
+		{ // 0 - no config
+			want: map[string]string{"t": "false", "tags": "", "v": "false"},
+		},
+		{ // 1 - config for the command and for every command
+			config: `{"Flags": {"*": {"v": "true", "nosuch": "x"}, "save": {"t": "true", "tags": "a b"}}}`,
+			want:   map[string]string{"t": "true", "tags": "a b", "v": "true"},
+		},
+		{ // 2 - environment overrides config, command line overrides both
+			config: `{"Flags": {"save": {"t": "true", "tags": "a"}}}`,
+			env:    "-tags=b -v -other=1",
+			args:   []string{"-tags=c", "-t=false"},
+			want:   map[string]string{"t": "false", "tags": "c", "v": "true"},
+		},
+		{ // 3 - unknown flag for the command
+			config: `{"Flags": {"save": {"nosuch": "x"}}}`,
+			werr:   true,
+		},
+		{ // 4 - non-bool flag without a value
+			env:  "-tags",
+			werr: true,
+		},
+		{ // 5 - bad value
+			config: `{"Flags": {"save": {"t": "maybe"}}}`,
+			werr:   true,
+		},
+		{ // 6 - bad vendor layout
+			config: `{"Vendor": "elsewhere"}`,
+			werr:   true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer os.Setenv("GODEPFLAGS", os.Getenv("GODEPFLAGS"))
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	for pos, test := range cases {
+		os.RemoveAll(scratch)
+		dir := filepath.Join(wd, scratch)
+		if err := os.MkdirAll(filepath.Join(dir, "Godeps"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if test.config != "" {
+			if err := ioutil.WriteFile(filepath.Join(dir, configFile), []byte(test.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		os.Setenv("GODEPFLAGS", test.env)
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		c := &Command{Name: "save"}
+		var o Options
+		o.AddFlags(&c.Flag)
+		c.Flag.Bool("t", false, "")
+		c.Flag.String("tags", "", "")
+		err := c.Parse(test.args)
+		os.Chdir(wd)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d Parse err = %v want %v", pos, err, test.werr)
+		}
+		if err != nil {
+			continue
+		}
+		got := make(map[string]string)
+		for name := range test.want {
+			got[name] = c.Flag.Lookup(name).Value.String()
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d flags = %v want %v", pos, got, test.want)
+		}
+	}
+}
+
+func TestCheckHosts(t *testing.T) {
+	defer func(c *Config) { projectConfig = c }(projectConfig)
+
+	projectConfig = &Config{}
+	if err := checkHosts([]Dependency{{ImportPath: "D"}}); err != nil {
+		t.Errorf("no AllowedHosts: %v", err)
+	}
+
+	projectConfig = &Config{AllowedHosts: []string{"github.com", "*.example.com"}}
+	ok := []Dependency{{ImportPath: "github.com/kr/fs"}, {ImportPath: "go.example.com/x/y"}}
+	if err := checkHosts(ok); err != nil {
+		t.Errorf("allowed hosts: %v", err)
+	}
+	bad := append(ok, Dependency{ImportPath: "gitlab.com/a/b"})
+	if err := checkHosts(bad); err != errHostNotAllowed("gitlab.com/a/b") {
+		t.Errorf("checkHosts = %v want %v", err, errHostNotAllowed("gitlab.com/a/b"))
+	}
+
+	projectConfig = &Config{Ignore: []string{"E/..."}}
+	if !isIgnored("E/sub") || isIgnored("D") {
+		t.Error("Ignore of the config not applied")
+	}
+}
@@ -0,0 +1,316 @@
+package godep
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// constraint is a parsed build constraint, from either a //go:build
+// line or one or more +build lines.
+type constraint interface {
+	eval(tag func(string) bool) bool
+	tags(add func(string))
+}
+
+type (
+	tagExpr string
+	notExpr struct{ x constraint }
+	andExpr struct{ x, y constraint }
+	orExpr  struct{ x, y constraint }
+)
+
+func (e tagExpr) eval(tag func(string) bool) bool { return tag(string(e)) }
+func (e notExpr) eval(tag func(string) bool) bool { return !e.x.eval(tag) }
+func (e andExpr) eval(tag func(string) bool) bool { return e.x.eval(tag) && e.y.eval(tag) }
+func (e orExpr) eval(tag func(string) bool) bool  { return e.x.eval(tag) || e.y.eval(tag) }
+
+func (e tagExpr) tags(add func(string)) { add(string(e)) }
+func (e notExpr) tags(add func(string)) { e.x.tags(add) }
+func (e andExpr) tags(add func(string)) { e.x.tags(add); e.y.tags(add) }
+func (e orExpr) tags(add func(string))  { e.x.tags(add); e.y.tags(add) }
+
+func and(x, y constraint) constraint {
+	if x == nil {
+		return y
+	}
+	return andExpr{x, y}
+}
+
+func or(x, y constraint) constraint {
+	if x == nil {
+		return y
+	}
+	return orExpr{x, y}
+}
+
+// headerLines returns the text after // of the comment lines in src
+// that can hold build constraints. As for go/build, these are in the
+// leading run of // comments and blank lines, and must be followed by a
+// blank line, so a doc comment touching the package clause has none.
+func headerLines(src []byte) []string {
+	var lines []string
+	end := 0 // lines before the last blank line
+	for len(src) > 0 {
+		line := src
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, src = line[:i], src[i+1:]
+		} else {
+			src = nil
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			end = len(lines)
+			continue
+		}
+		if !bytes.HasPrefix(line, []byte("//")) {
+			break
+		}
+		lines = append(lines, string(line[len("//"):]))
+	}
+	return lines[:end]
+}
+
+// headerConstraint returns the constraint of a file, given its
+// headerLines. A //go:build line takes
+// precedence over +build lines, which are and-ed together; malformed
+// ones are skipped, as the go tool does. It returns nil if the file
+// has no constraint.
+func headerConstraint(lines []string) (constraint, error) {
+	var plus constraint
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "go:build ") {
+			return parseGoBuild(line[len("go:build "):])
+		}
+		if strings.HasPrefix(line, "+build ") {
+			c, err := parsePlusBuild(line[len("+build "):])
+			if err != nil {
+				debugln(err)
+				continue
+			}
+			plus = and(plus, c)
+		}
+	}
+	return plus, nil
+}
+
+// parsePlusBuild parses the body of a +build line: space separated
+// alternatives, each a comma separated list of terms that must all
+// hold, each term a tag optionally negated with a single !.
+func parsePlusBuild(line string) (constraint, error) {
+	var c constraint
+	for _, alt := range strings.Fields(line) {
+		var a constraint
+		for _, term := range strings.Split(alt, ",") {
+			name := strings.TrimPrefix(term, "!")
+			if !isTag(name) {
+				return nil, fmt.Errorf("invalid +build term %q", term)
+			}
+			var t constraint = tagExpr(name)
+			if name != term {
+				t = notExpr{t}
+			}
+			a = and(a, t)
+		}
+		c = or(c, a)
+	}
+	if c == nil {
+		return nil, fmt.Errorf("empty +build line")
+	}
+	return c, nil
+}
+
+// parseGoBuild parses a //go:build expression: tags combined with !,
+// && and ||, grouped with parentheses, where && binds tighter than ||.
+func parseGoBuild(s string) (constraint, error) {
+	p := &exprParser{s: s}
+	c := p.or()
+	if p.err == nil && p.next() != "" {
+		p.err = fmt.Errorf("unexpected %q", p.tok)
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("invalid //go:build line %q: %v", s, p.err)
+	}
+	return c, nil
+}
+
+type exprParser struct {
+	s   string
+	tok string // the last token read by next
+	err error
+}
+
+// next returns the next token, or "" at the end of the input.
+func (p *exprParser) next() string {
+	p.s = strings.TrimLeft(p.s, " \t")
+	if p.s == "" {
+		p.tok = ""
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(p.s, "&&"), strings.HasPrefix(p.s, "||"):
+		p.tok = p.s[:2]
+	case p.s[0] == '!' || p.s[0] == '(' || p.s[0] == ')':
+		p.tok = p.s[:1]
+	default:
+		i := strings.IndexFunc(p.s, func(r rune) bool { return !isTagRune(r) })
+		if i < 0 {
+			i = len(p.s)
+		}
+		if i == 0 {
+			p.err = fmt.Errorf("unexpected %q", p.s[:1])
+			p.tok = ""
+			return ""
+		}
+		p.tok = p.s[:i]
+	}
+	p.s = p.s[len(p.tok):]
+	return p.tok
+}
+
+// peek returns the next token without consuming it.
+func (p *exprParser) peek() string {
+	s := p.s
+	t := p.next()
+	p.s = s
+	return t
+}
+
+func (p *exprParser) or() constraint {
+	c := p.and()
+	for p.err == nil && p.peek() == "||" {
+		p.next()
+		c = orExpr{c, p.and()}
+	}
+	return c
+}
+
+func (p *exprParser) and() constraint {
+	c := p.not()
+	for p.err == nil && p.peek() == "&&" {
+		p.next()
+		c = andExpr{c, p.not()}
+	}
+	return c
+}
+
+func (p *exprParser) not() constraint {
+	if p.err != nil {
+		return nil
+	}
+	switch t := p.next(); {
+	case t == "!":
+		return notExpr{p.not()}
+	case t == "(":
+		c := p.or()
+		if p.err == nil && p.next() != ")" {
+			p.err = fmt.Errorf("missing )")
+		}
+		return c
+	case isTag(t):
+		return tagExpr(t)
+	case t == "":
+		p.err = fmt.Errorf("unexpected end of expression")
+	default:
+		p.err = fmt.Errorf("unexpected %q", t)
+	}
+	return nil
+}
+
+func isTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !isTagRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTagRune(r rune) bool {
+	return r == '_' || r == '.' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// maxFreeTags bounds the tags satisfiable will enumerate; a constraint
+// with more unknown tags is assumed to be satisfiable.
+const maxFreeTags = 10
+
+// satisfiable reports whether c holds for t under some setting of the
+// tags it mentions that godep has no opinion on. Tags in ignoreTags
+// are false, tags in buildTags true, goN.M tags hold when the project's
+// go version is at least N.M, and platform tags are decided by t. The
+// zero target tries every known platform.
+func (t buildTarget) satisfiable(c constraint) bool {
+	if t.goos == "" {
+		var platform bool
+		c.tags(func(tag string) {
+			platform = platform || tag == "unix" || isKnown(knownOS, tag) || isKnown(knownArch, tag)
+		})
+		if !platform {
+			return (buildTarget{"linux", "amd64"}).satisfiable(c)
+		}
+		for _, goos := range strings.Fields(knownOS) {
+			for _, goarch := range strings.Fields(knownArch) {
+				if (buildTarget{goos, goarch}).satisfiable(c) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	var free []string
+	c.tags(func(tag string) {
+		if _, ok := t.fixedTag(tag); !ok && !containsString(free, tag) {
+			free = append(free, tag)
+		}
+	})
+	if len(free) > maxFreeTags {
+		return true
+	}
+	for set := 0; set < 1<<uint(len(free)); set++ {
+		ok := c.eval(func(tag string) bool {
+			if v, ok := t.fixedTag(tag); ok {
+				return v
+			}
+			for i, f := range free {
+				if f == tag {
+					return set&(1<<uint(i)) != 0
+				}
+			}
+			return false
+		})
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// anyTarget reports whether c is satisfiable for one of the targets
+// being scanned for.
+func anyTarget(c constraint) bool {
+	for _, t := range scanTargets() {
+		if t.satisfiable(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedTag returns the value of tag for t, and whether it has one.
+func (t buildTarget) fixedTag(tag string) (v, ok bool) {
+	switch {
+	case containsString(ignoreTags, tag):
+		return false, true
+	case containsString(buildTags, tag):
+		return true, true
+	case versionMatch.MatchString(tag):
+		return isSameOrNewer(tag, majorGoVersion), true
+	case tag == "unix" || isKnown(knownOS, tag) || isKnown(knownArch, tag):
+		return t.matchTag(tag), true
+	}
+	return false, false
+}
@@ -0,0 +1,114 @@
+package godep
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeaderConstraint(t *testing.T) {
+	var cases = []struct {
+		lines []string
+		tags  string // tags that are set
+		want  bool
+	}{
+		{[]string{"+build a"}, "a", true},
+		{[]string{"+build a"}, "", false},
+		{[]string{"+build a b"}, "b", true},
+		{[]string{"+build a,b"}, "b", false},
+		{[]string{"+build a,!b"}, "a", true},
+		{[]string{"+build a", "+build b"}, "a", false},
+		{[]string{"go:build a && (b || !c)"}, "a", true},
+		{[]string{"go:build a && (b || !c)"}, "a c", false},
+		{[]string{"go:build a || b && c"}, "a", true},
+		{[]string{"go:build !(a || b)"}, "b", false},
+		{[]string{"go:build !!a"}, "a", true},
+		{[]string{"go:build a", "+build b"}, "a", true}, // go:build wins
+		{[]string{" +build a", "not a constraint"}, "a", true},
+		{[]string{"+build a", "+build !*"}, "a", true}, // malformed lines are skipped
+	}
+	for pos, test := range cases {
+		c, err := headerConstraint(test.lines)
+		if err != nil {
+			t.Errorf("%d headerConstraint(%q) err = %v", pos, test.lines, err)
+			continue
+		}
+		set := func(tag string) bool {
+			return containsString(strings.Fields(test.tags), tag)
+		}
+		if g := c.eval(set); g != test.want {
+			t.Errorf("%d %q with %q = %v want %v", pos, test.lines, test.tags, g, test.want)
+		}
+	}
+
+	if c, err := headerConstraint([]string{"a comment"}); c != nil || err != nil {
+		t.Errorf("headerConstraint(no constraint) = %v, %v want nil, nil", c, err)
+	}
+	for _, bad := range []string{"a &&", "(a", "a b", "a & b", "!", "a || || b", ")"} {
+		if _, err := headerConstraint([]string{"go:build " + bad}); err == nil {
+			t.Errorf("headerConstraint(go:build %s) err = nil", bad)
+		}
+	}
+}
+
+func TestHeaderLines(t *testing.T) {
+	var cases = []struct {
+		src  string
+		want []string
+	}{
+		{"// +build a\n\npackage p\n", []string{" +build a"}},
+		{"// Copyright\n\n//go:build a\n// +build a\n\n// Package p.\npackage p\n", []string{" Copyright", "go:build a", " +build a"}},
+		{"// Package p is built\n// +build linux\npackage p\n", nil}, // a doc comment
+		{"// +build a\npackage p\n", nil},
+		{"/* c */\n// +build a\n\npackage p\n", nil},
+		{"package p\n\n// +build a\n", nil},
+		{"\r\n// +build a\r\n\r\npackage p\r\n", []string{" +build a"}},
+	}
+	for pos, test := range cases {
+		if g := headerLines([]byte(test.src)); !reflect.DeepEqual(g, test.want) && len(g)+len(test.want) > 0 {
+			t.Errorf("%d headerLines(%q) = %q want %q", pos, test.src, g, test.want)
+		}
+	}
+}
+
+func TestSatisfiable(t *testing.T) {
+	defer func(v string, it, bt []string) {
+		majorGoVersion, ignoreTags, buildTags = v, it, bt
+	}(majorGoVersion, ignoreTags, buildTags)
+	majorGoVersion = "go1.6"
+	ignoreTags = []string{"appengine", "ignore"}
+	buildTags = []string{"mytag"}
+
+	linux := buildTarget{"linux", "amd64"}
+	var cases = []struct {
+		t    buildTarget
+		expr string
+		want bool
+	}{
+		{linux, "ignore", false},
+		{linux, "!appengine", true},
+		{linux, "appengine || linux", true},
+		{linux, "!mytag", false},
+		{linux, "go1.5", true},
+		{linux, "go1.7", false},
+		{linux, "!go1.7", true},
+		{linux, "cgo", true},
+		{linux, "cgo && !cgo", false},
+		{linux, "windows", false},
+		{linux, "unix && !darwin", true},
+		{buildTarget{}, "windows", true},
+		{buildTarget{}, "linux && windows", false},
+		{buildTarget{}, "!linux && !amd64", true},
+		{buildTarget{}, "linux && !unix", false},
+		{buildTarget{}, "ignore && linux", false},
+	}
+	for pos, test := range cases {
+		c, err := parseGoBuild(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := test.t.satisfiable(c); g != test.want {
+			t.Errorf("%d %v.satisfiable(%s) = %v want %v", pos, test.t, test.expr, g, test.want)
+		}
+	}
+}
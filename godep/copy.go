@@ -0,0 +1,163 @@
+package godep
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// linkMode is how copyFile places files that need no changes on the
+// way into the vendor tree: "" copies them, "hard" hard links them
+// and "reflink" clones them. A file that cannot be linked is copied.
+var linkMode string
+
+func addCopyFlags(f *flag.FlagSet) {
+	f.StringVar(&linkMode, "link", "", "hard link (hard) or clone (reflink) files that need no changes, where the filesystem allows")
+}
+
+// copyCounts tallies the files copySrc handled, for -v.
+type copyCounts struct {
+	written, linked, unchanged, deleted int
+
+	keep map[string]bool // destination files to keep, or nil
+}
+
+var copied copyCounts
+
+func (c copyCounts) String() string {
+	return fmt.Sprintf("%d written, %d linked, %d unchanged, %d deleted", c.written, c.linked, c.unchanged, c.deleted)
+}
+
+func checkLinkMode() error {
+	switch linkMode {
+	case "", "hard", "reflink":
+		return nil
+	}
+	return errBadLinkMode(linkMode)
+}
+
+// vendorContents returns what src becomes in the vendor tree: its
+// contents, with the import comment stripped if it is a Go file.
+func vendorContents(src string) (data []byte, same bool, err error) {
+	raw, err := ioutil.ReadFile(src)
+	if err != nil {
+		return nil, false, err
+	}
+	return vendorBytes(src, raw)
+}
+
+// vendorBytes is like vendorContents for a file name holding raw.
+func vendorBytes(name string, raw []byte) (data []byte, same bool, err error) {
+	if filepath.Ext(name) != ".go" {
+		return raw, true, nil
+	}
+	var buf bytes.Buffer
+	if err := copyWithoutImportComment(&buf, bytes.NewReader(raw)); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), bytes.Equal(buf.Bytes(), raw), nil
+}
+
+// sameContents reports whether the regular file dst has mode and
+// holds data, comparing sizes before hashing.
+func sameContents(dst string, mode os.FileMode, data []byte) bool {
+	fi, err := os.Lstat(dst)
+	if err != nil || !fi.Mode().IsRegular() || fi.Mode() != mode || fi.Size() != int64(len(data)) {
+		return false
+	}
+	f, err := os.Open(dst)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	return bytes.Equal(h.Sum(nil), sha256Sum(data))
+}
+
+func sha256Sum(data []byte) []byte {
+	s := sha256.Sum256(data)
+	return s[:]
+}
+
+// linkFile puts a link to src at tmp, as linkMode asks.
+func linkFile(tmp, src string) error {
+	if linkMode == "hard" {
+		return os.Link(src, tmp)
+	}
+	return reflink(tmp, src)
+}
+
+// replaceFile writes data to dst with mode by way of a temporary file,
+// so a hard link at dst is replaced rather than written through.
+func replaceFile(dst string, mode os.FileMode, data []byte) error {
+	tmp := dst + ".godep-tmp"
+	w, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// pruneTree removes the files under root that copySrc did not keep,
+// and any directories left empty.
+func pruneTree(root string, keep map[string]bool) error {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if keep[path] {
+			return nil
+		}
+		debugln("removing", path)
+		copied.deleted++
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+	// Deepest first, so parents are empty by the time they are tried.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, d := range dirs {
+		if f, err := os.Open(d); err == nil {
+			_, err = f.Readdirnames(1)
+			f.Close()
+			if err == io.EOF {
+				if err := os.Remove(d); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package godep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyFileIncremental(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godep-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { linkMode = "" }()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	writeFile(filepath.Join(src, "a.go"), "package a // import \"x/a\"\n")
+	writeFile(filepath.Join(src, "b.txt"), "b\n")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	cases := []struct {
+		link    string
+		change  string // file in src to change before copying, if any
+		want    copyCounts
+		wantA   string
+		linkedB bool
+	}{
+		{want: copyCounts{written: 2}, wantA: "package a\n"},
+		{want: copyCounts{unchanged: 2}, wantA: "package a\n"},
+		{change: "a.go", want: copyCounts{written: 1, unchanged: 1}, wantA: "package a // changed\n"},
+		{link: "hard", change: "b.txt", want: copyCounts{linked: 1, unchanged: 1}, wantA: "package a // changed\n", linkedB: true},
+	}
+	for pos, test := range cases {
+		linkMode = test.link
+		switch test.change {
+		case "a.go":
+			writeFile(filepath.Join(src, "a.go"), "package a // changed\n")
+		case "b.txt":
+			writeFile(filepath.Join(src, "b.txt"), "b changed\n")
+		}
+		for _, name := range []string{"a.go", "b.txt"} {
+			os.Chtimes(filepath.Join(dst, name), old, old)
+		}
+		copied = copyCounts{}
+		for _, name := range []string{"a.go", "b.txt"} {
+			clearStatCache()
+			if err := copyFile(filepath.Join(dst, name), filepath.Join(src, name)); err != nil {
+				t.Fatal(pos, err)
+			}
+		}
+		if copied.String() != test.want.String() {
+			t.Errorf("%d counts = %v want %v", pos, copied, test.want)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dst, "a.go"))
+		if err != nil {
+			t.Fatal(pos, err)
+		}
+		if string(b) != test.wantA {
+			t.Errorf("%d a.go = %q want %q", pos, b, test.wantA)
+		}
+		if test.want.unchanged == 2 {
+			fi, err := os.Stat(filepath.Join(dst, "a.go"))
+			if err != nil {
+				t.Fatal(pos, err)
+			}
+			if !fi.ModTime().Equal(old) {
+				t.Errorf("%d unchanged a.go was rewritten", pos)
+			}
+		}
+		sfi, _ := os.Stat(filepath.Join(src, "b.txt"))
+		dfi, _ := os.Stat(filepath.Join(dst, "b.txt"))
+		if got := os.SameFile(sfi, dfi); got != test.linkedB {
+			t.Errorf("%d b.txt linked = %v want %v", pos, got, test.linkedB)
+		}
+	}
+
+	// Rewriting a hard linked file must not write through to GOPATH.
+	if err := writePatchedFile(filepath.Join(dst, "b.txt"), []byte("patched\n")); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(src, "b.txt")); string(b) != "b changed\n" {
+		t.Errorf("src b.txt = %q after patching the vendored copy", b)
+	}
+}
+
+func TestPruneTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godep-prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keep := filepath.Join(dir, "D", "d.go")
+	gone := filepath.Join(dir, "D", "old.go")
+	sub := filepath.Join(dir, "D", "sub", "s.go")
+	for _, name := range []string{keep, gone, sub} {
+		writeFile(name, "package x\n")
+	}
+	copied = copyCounts{}
+	if err := pruneTree(filepath.Join(dir, "D"), map[string]bool{keep: true}); err != nil {
+		t.Fatal(err)
+	}
+	if copied.deleted != 2 {
+		t.Errorf("deleted = %d want 2", copied.deleted)
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Error(err)
+	}
+	for _, name := range []string{gone, filepath.Dir(sub)} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", name)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"fmt"
@@ -11,14 +11,23 @@ import (
 // A Dependency is a specific revision of a package.
 type Dependency struct {
 	ImportPath string
-	Comment    string `json:",omitempty"` // Description of commit, if present.
-	Rev        string // VCS-specific commit ID.
+	Comment    string   `json:",omitempty"` // Description of commit, if present.
+	Rev        string   // VCS-specific commit ID.
+	Patches    []string `json:",omitempty"` // Local patches applied on top of Rev, in order.
+	Hold       bool     `json:",omitempty"` // Update leaves this dependency alone.
+	Reason     string   `json:",omitempty"` // Why the dependency is held.
+	Targets    []string `json:",omitempty"` // GOOS/GOARCH targets that need it, if targets are set.
+	Include    []string `json:",omitempty"` // Glob patterns of files to copy that godep would skip.
+	Exclude    []string `json:",omitempty"` // Glob patterns of files never to copy.
 
 	// used by command save & update
 	ws   string // workspace
 	root string // import path to repo root
 	dir  string // full path to package
 
+	// used by command save -flatten
+	vendored string // import path of the nested copy this was hoisted from
+
 	// used by command update
 	matched bool // selected for update by command line
 	pkg     *Package
@@ -28,6 +37,13 @@ type Dependency struct {
 	vcs *VCS
 }
 
+// byImportPath sorts dependencies by import path.
+type byImportPath []Dependency
+
+func (a byImportPath) Len() int           { return len(a) }
+func (a byImportPath) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byImportPath) Less(i, j int) bool { return a[i].ImportPath < a[j].ImportPath }
+
 func eqDeps(a, b []Dependency) bool {
 	ok := true
 	for _, da := range a {
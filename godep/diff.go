@@ -0,0 +1,309 @@
+package godep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+var cmdDiff = &Command{
+	Name:  "diff",
+	Args:  "[-summary | -src pkg [rev rev]] [-log] [-tags 'tag...'] [-ignoretags 'tag...'] [-targets 'os/arch...'] [ref [ref]]",
+	Short: "shows the diff between current and previously saved set of dependencies",
+	Long: `
+Shows the difference, in a unified diff format, between the
+current set of dependencies and those generated on a
+previous 'go save' execution.
+
+If -summary is given, diff instead lists the dependencies added,
+removed and changed in revision or comment, grouped by repository,
+and any change of GoVersion. With -json, the same is instead the Data
+of a single result event with Action diff, as a JSON object, with the
+commits listed by -log in the Log of each repository.
+
+If refs, such as tags or commits of the project's repository, are
+given, diff compares the Godeps.json recorded at the first with that
+at the second, or with the one in the working tree, instead of
+scanning GOPATH, and lists the dependencies that differ as for
+-summary. With -log, the commits made upstream between the
+two revisions of each changed dependency, as found in GOPATH, are
+listed too.
+
+If -src is given, diff instead shows, in a unified diff format, how
+the files vendored for the dependencies at or below pkg differ between
+the revision in Godeps.json and the working tree in GOPATH, or between
+the two revisions given. Only the files save would copy are compared,
+and a count of the lines added and removed in each package follows.
+
+Diff exits with status 1 if the dependencies differ.
+
+The -tags, -ignoretags and -targets flags are as for save.
+`,
+	Run:          runDiff,
+	OnlyInGOPATH: true,
+}
+
+var (
+	diffSummary, diffLog bool
+	diffSrc              string
+)
+
+func init() {
+	cmdDiff.Flag.BoolVar(&diffSummary, "summary", false, "list the dependencies that differ")
+	cmdDiff.Flag.StringVar(&diffSrc, "src", "", "diff the vendored source of this dependency")
+	cmdDiff.Flag.BoolVar(&diffLog, "log", false, "list the upstream commits of each changed dependency")
+	addBuildFlags(&cmdDiff.Flag)
+}
+
+func runDiff(cmd *Command, args []string) {
+	if diffSrc != "" {
+		if len(args) != 0 && len(args) != 2 {
+			cmd.UsageExit()
+		}
+		changed, err := srcDiff(stdout, diffSrc, args)
+		if err != nil {
+			fatal(err)
+		}
+		if changed {
+			exit(1)
+		}
+		return
+	}
+	if len(args) > 2 {
+		cmd.UsageExit()
+	}
+	s := newRepoSession()
+	var gold, gnew *Godeps
+	var err error
+	if len(args) > 0 {
+		gold, gnew, err = manifestsAt(s, args)
+	} else {
+		gold, gnew, err = currentDeps(s)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	dd := diffDeps(gold, gnew)
+	if diffLog {
+		dd.addLogs(s)
+	}
+	switch {
+	case events != nil:
+		result("diff", "", "", dd)
+	case diffSummary || diffLog || len(args) > 0:
+		dd.writeText(stdout)
+	default:
+		diff, err := diffStr(gold, gnew)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Fprintln(stdout, diff)
+		for _, p := range gnew.ignored {
+			fmt.Fprintln(stdout, "excluded by Ignore:", p)
+		}
+	}
+	if !dd.empty() {
+		exit(1)
+	}
+}
+
+// currentDeps returns the dependencies in Godeps.json and those found in
+// GOPATH, as save would record them.
+func currentDeps(s *repoSession) (gold, gnew *Godeps, err error) {
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return nil, nil, err
+	}
+	ignoreImports = g.Ignore
+	cfg := g
+	if err := setBuildConfig(&cfg); err != nil {
+		return nil, nil, err
+	}
+	dot, err := loadPackages(".")
+	if err != nil {
+		return nil, nil, err
+	}
+	gnew = &Godeps{
+		ImportPath: dot[0].ImportPath,
+		GoVersion:  g.GoVersion,
+		Ignore:     g.Ignore,
+		Tags:       cfg.Tags,
+		IgnoreTags: cfg.IgnoreTags,
+		Targets:    cfg.Targets,
+		Flatten:    cfg.Flatten,
+		Include:    cfg.Include,
+		Exclude:    cfg.Exclude,
+	}
+	if err := gnew.fill(s, dot, dot[0].ImportPath); err != nil {
+		return nil, nil, err
+	}
+	return &g, gnew, nil
+}
+
+// diffStr returns a unified diff string of two Godeps.
+func diffStr(a, b *Godeps) (string, error) {
+	var ab, bb bytes.Buffer
+
+	_, err := a.writeTo(&ab)
+	if err != nil {
+		fatal(err)
+	}
+
+	_, err = b.writeTo(&bb)
+	if err != nil {
+		fatal(err)
+	}
+
+	diff := difflib.UnifiedDiff{
+		A:        difflib.SplitLines(ab.String()),
+		B:        difflib.SplitLines(bb.String()),
+		FromFile: b.file(),
+		ToFile:   "$GOPATH",
+		Context:  10,
+	}
+	return difflib.GetUnifiedDiffString(diff)
+}
+
+// DepsDiff is the difference between two sets of dependencies, as
+// reported by diff.
+type DepsDiff struct {
+	GoVersion *DiffChange `json:",omitempty"`
+	Repos     []RepoDiff  `json:",omitempty"`
+}
+
+// DiffChange is a value that changed.
+type DiffChange struct {
+	Old, New string
+}
+
+// RepoDiff is the dependencies from one repository that differ.
+type RepoDiff struct {
+	Root    string
+	Added   []PlanDep   `json:",omitempty"`
+	Removed []PlanDep   `json:",omitempty"`
+	Changed []DepChange `json:",omitempty"`
+	Log     []string    `json:",omitempty"` // upstream commits, with diff -log
+}
+
+// DepChange is a dependency whose revision or comment changed.
+type DepChange struct {
+	ImportPath string
+	Rev        DiffChange
+	Comment    *DiffChange `json:",omitempty"` // nil if unchanged
+}
+
+// diffDeps returns the difference between the dependencies of a and
+// those of b.
+func diffDeps(a, b *Godeps) *DepsDiff {
+	dd := new(DepsDiff)
+	if a.GoVersion != b.GoVersion {
+		dd.GoVersion = &DiffChange{Old: a.GoVersion, New: b.GoVersion}
+	}
+	all := append(append([]Dependency(nil), a.Deps...), b.Deps...)
+	repos := make(map[string]*RepoDiff)
+	repo := func(d Dependency) *RepoDiff {
+		root := depRepoRoot(d, all)
+		r := repos[root]
+		if r == nil {
+			r = &RepoDiff{Root: root}
+			repos[root] = r
+		}
+		return r
+	}
+	for _, d := range b.Deps {
+		var found bool
+		for _, o := range a.Deps {
+			if o.ImportPath != d.ImportPath {
+				continue
+			}
+			found = true
+			if o.Rev == d.Rev && o.Comment == d.Comment {
+				continue
+			}
+			c := DepChange{ImportPath: d.ImportPath, Rev: DiffChange{Old: o.Rev, New: d.Rev}}
+			if o.Comment != d.Comment {
+				c.Comment = &DiffChange{Old: o.Comment, New: d.Comment}
+			}
+			r := repo(d)
+			r.Changed = append(r.Changed, c)
+		}
+		if !found {
+			r := repo(d)
+			r.Added = append(r.Added, PlanDep{ImportPath: d.ImportPath, Rev: d.Rev, Comment: d.Comment})
+		}
+	}
+	for _, d := range subDeps(a.Deps, b.Deps) {
+		r := repo(d)
+		r.Removed = append(r.Removed, PlanDep{ImportPath: d.ImportPath, Rev: d.Rev, Comment: d.Comment})
+	}
+	var roots []string
+	for root := range repos {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		dd.Repos = append(dd.Repos, *repos[root])
+	}
+	return dd
+}
+
+// depRepoRoot returns the import path of the repository holding d: the
+// root found by save for it or for another dependency in all, or the
+// root known for its host, or else the shortest import path in all
+// that contains it.
+func depRepoRoot(d Dependency, all []Dependency) string {
+	if d.root != "" {
+		return d.root
+	}
+	for _, o := range all {
+		if o.root != "" && containsPathPrefix([]string{o.root}, d.ImportPath) {
+			return o.root
+		}
+	}
+	if r := guessRepoRoot(d.ImportPath); r != "" {
+		return r
+	}
+	root := d.ImportPath
+	for _, o := range all {
+		if len(o.ImportPath) < len(root) && containsPathPrefix([]string{o.ImportPath}, d.ImportPath) {
+			root = o.ImportPath
+		}
+	}
+	return root
+}
+
+func (dd *DepsDiff) empty() bool {
+	return dd.GoVersion == nil && len(dd.Repos) == 0
+}
+
+func (dd *DepsDiff) writeText(w io.Writer) {
+	if dd.GoVersion != nil {
+		fmt.Fprintf(w, "GoVersion %s -> %s\n", dd.GoVersion.Old, dd.GoVersion.New)
+	}
+	for _, r := range dd.Repos {
+		fmt.Fprintf(w, "%s:\n", r.Root)
+		for _, d := range r.Added {
+			fmt.Fprintf(w, "\t+ %s %s\n", d.ImportPath, revDesc(d.Rev, d.Comment))
+		}
+		for _, d := range r.Removed {
+			fmt.Fprintf(w, "\t- %s %s\n", d.ImportPath, revDesc(d.Rev, d.Comment))
+		}
+		for _, c := range r.Changed {
+			fmt.Fprintf(w, "\t~ %s %s -> %s", c.ImportPath, shortRev(c.Rev.Old), shortRev(c.Rev.New))
+			if c.Comment != nil {
+				fmt.Fprintf(w, " (%s -> %s)", c.Comment.Old, c.Comment.New)
+			}
+			fmt.Fprintln(w)
+		}
+		for _, l := range r.Log {
+			fmt.Fprintf(w, "\t\t%s\n", l)
+		}
+	}
+	if dd.empty() {
+		fmt.Fprintln(w, "no changes")
+	}
+}
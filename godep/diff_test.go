@@ -1,7 +1,9 @@
-package main
+package godep
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -103,3 +105,53 @@ func diffsEqual(a, b []string) bool {
 	}
 	return true
 }
+
+func TestDiffDeps(t *testing.T) {
+	a := &Godeps{
+		GoVersion: "go1.6",
+		Deps: []Dependency{
+			{ImportPath: "D", Rev: "d1"},
+			{ImportPath: "D/sub", Rev: "d1"},
+			{ImportPath: "github.com/x/y/a", Rev: "y1", Comment: "v1"},
+			{ImportPath: "github.com/x/y/b", Rev: "y1", Comment: "v1"},
+			{ImportPath: "E", Rev: "e1"},
+		},
+	}
+	b := &Godeps{
+		GoVersion: "go1.7",
+		Deps: []Dependency{
+			{ImportPath: "D", Rev: "d1"},
+			{ImportPath: "D/sub", Rev: "d2"},
+			{ImportPath: "F", Rev: "f1", root: "F"},
+			{ImportPath: "github.com/x/y/a", Rev: "y2", Comment: "v2"},
+			{ImportPath: "github.com/x/y/c", Rev: "y2", Comment: "v2"},
+		},
+	}
+	want := &DepsDiff{
+		GoVersion: &DiffChange{Old: "go1.6", New: "go1.7"},
+		Repos: []RepoDiff{
+			{Root: "D", Changed: []DepChange{{ImportPath: "D/sub", Rev: DiffChange{"d1", "d2"}}}},
+			{Root: "E", Removed: []PlanDep{{ImportPath: "E", Rev: "e1"}}},
+			{Root: "F", Added: []PlanDep{{ImportPath: "F", Rev: "f1"}}},
+			{
+				Root:    "github.com/x/y",
+				Added:   []PlanDep{{ImportPath: "github.com/x/y/c", Rev: "y2", Comment: "v2"}},
+				Removed: []PlanDep{{ImportPath: "github.com/x/y/b", Rev: "y1", Comment: "v1"}},
+				Changed: []DepChange{{ImportPath: "github.com/x/y/a", Rev: DiffChange{"y1", "y2"}, Comment: &DiffChange{"v1", "v2"}}},
+			},
+		},
+	}
+	got := diffDeps(a, b)
+	if !reflect.DeepEqual(got, want) {
+		var gb, wb bytes.Buffer
+		got.writeText(&gb)
+		want.writeText(&wb)
+		t.Errorf("diffDeps =\n%s\nwant\n%s", gb.String(), wb.String())
+	}
+	if got.empty() {
+		t.Error("diff is empty")
+	}
+	if dd := diffDeps(a, a); !dd.empty() {
+		t.Errorf("diff of a with itself = %+v, want empty", dd)
+	}
+}
@@ -0,0 +1,14 @@
+/*
+Package godep implements the godep command: reading and writing
+Godeps/Godeps.json, finding the dependencies of a project, copying them
+into it, and checking them out in GOPATH.
+
+Programs can call Save, Update, Restore, Discover, LoadPackages and
+ReadGodeps directly instead of running godep. Each call takes the
+project directory and other settings in an Options value. Calls share
+the process's working directory, so they are run one at a time.
+
+The commands of the godep tool are in Commands; the tool parses their
+flags and runs them with Command.Exec.
+*/
+package godep
@@ -0,0 +1,150 @@
+package godep
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	errorLoadingDeps         = errors.New("error loading dependencies")
+	errorLoadingPackages     = errors.New("error loading packages")
+	errorCopyingSourceCode   = errors.New("error copying source code")
+	errorNoPackagesUpdatable = errors.New("no packages can be updated")
+	errorPatchConflicts      = errors.New("some local patches failed to apply")
+	errorPlanStale           = errors.New("the workspace has changed since the plan was made; make a new plan")
+	errorFlattenConflicts    = errors.New("nested vendor trees conflict with the revisions vendored")
+	errReflinkUnsupported    = errors.New("reflinks are not supported on this platform")
+	errorNoWorkspace         = errors.New("no Godeps/_workspace/src to migrate")
+	errorVendorExists        = errors.New("vendor is not empty; remove it first")
+	errorCheckFailed         = errors.New("the migrated project fails godep check")
+	errorTxnPending          = errors.New("an interrupted save or update must be rolled back first; run it again without -n")
+	errorInterrupted         = errors.New("interrupted")
+)
+
+// errorCodes are the codes of the errors above in -json error events.
+// Like the codes of the error types below, they are stable: a code is
+// never reused or changed.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{errorLoadingDeps, "loading-deps"},
+	{errorLoadingPackages, "loading-packages"},
+	{errorCopyingSourceCode, "copying-source"},
+	{errorNoPackagesUpdatable, "no-packages-updatable"},
+	{errorPatchConflicts, "patch-conflicts"},
+	{errorPlanStale, "plan-stale"},
+	{errorFlattenConflicts, "flatten-conflicts"},
+	{errReflinkUnsupported, "reflink-unsupported"},
+	{errorNoWorkspace, "no-workspace"},
+	{errorVendorExists, "vendor-exists"},
+	{errorCheckFailed, "check-failed"},
+	{errorTxnPending, "txn-pending"},
+	{errorInterrupted, "interrupted"},
+}
+
+// A codedError is an error of a type with its own code.
+type codedError interface {
+	error
+	code() string
+}
+
+// errorCode returns the code of err in -json error events: "not-exist"
+// for a missing file, and "error" for errors without a code of their
+// own.
+func errorCode(err error) string {
+	if c, ok := err.(codedError); ok {
+		return c.code()
+	}
+	for _, c := range errorCodes {
+		if err == c.err {
+			return c.code
+		}
+	}
+	if os.IsNotExist(err) {
+		return "not-exist"
+	}
+	return "error"
+}
+
+type errPackageNotFound struct {
+	path string
+}
+
+func (e errPackageNotFound) Error() string {
+	return "Package (" + e.path + ") not found"
+}
+
+func (e errPackageNotFound) code() string { return "package-not-found" }
+
+type errPatchConflict struct {
+	root, patch string
+	err         error
+}
+
+func (e errPatchConflict) Error() string {
+	return "patch " + e.patch + " does not apply to " + e.root + ": " + e.err.Error()
+}
+
+func (e errPatchConflict) code() string { return "patch-conflict" }
+
+type errNoSuchDep string
+
+func (e errNoSuchDep) Error() string {
+	return "no dependency in Godeps.json matches " + string(e)
+}
+
+func (e errNoSuchDep) code() string { return "no-such-dep" }
+
+type errVendorEdited []string
+
+func (e errVendorEdited) Error() string {
+	files := []string(e)
+	if len(files) > 5 {
+		files = append(files[:5:5], "...")
+	}
+	return fmt.Sprintf("%d vendored files were edited by hand and would be overwritten or removed: %s; keep the changes with 'godep patch create', or use -force to discard them",
+		len(e), strings.Join(files, ", "))
+}
+
+func (e errVendorEdited) code() string { return "vendor-edited" }
+
+type errBadTarget string
+
+func (e errBadTarget) Error() string {
+	return "invalid target " + string(e) + ", want GOOS/GOARCH"
+}
+
+func (e errBadTarget) code() string { return "bad-target" }
+
+type errBadLinkMode string
+
+func (e errBadLinkMode) Error() string {
+	return "invalid -link " + string(e) + ", want hard or reflink"
+}
+
+func (e errBadLinkMode) code() string { return "bad-link-mode" }
+
+type errFlattenConflict struct {
+	pkg         string
+	path1, rev1 string
+	path2, rev2 string
+}
+
+func (e errFlattenConflict) Error() string {
+	return "conflict: " + e.pkg + " was vendored at " + e.rev1 + " in " + e.path1 + " but at " + e.rev2 + " in " + e.path2
+}
+
+func (e errFlattenConflict) code() string { return "flatten-conflict" }
+
+type errFlattenUnknown struct {
+	pkg, path string
+}
+
+func (e errFlattenUnknown) Error() string {
+	return "cannot flatten " + e.path + ": the revision of " + e.pkg + " is not recorded; put " + e.pkg + " in GOPATH"
+}
+
+func (e errFlattenUnknown) code() string { return "flatten-unknown" }
@@ -0,0 +1,179 @@
+package godep
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// An Event is one line of the output of a command run with -json.
+//
+// Type is one of:
+//
+//	progress  a message about what the command is doing (Message)
+//	warning   a problem that did not stop the command (Message)
+//	debug     debug output, with -d (Message)
+//	output    a line of the command's usual output (Message)
+//	result    the outcome for one dependency or repository (Action,
+//	          ImportPath, Rev, Message and Data, as the command has them)
+//	error     the error that stopped the command (Code, Message)
+//	summary   the last event, with the exit status and counts (Summary)
+type Event struct {
+	Type       string
+	Command    string
+	Action     string        `json:",omitempty"`
+	ImportPath string        `json:",omitempty"`
+	Rev        string        `json:",omitempty"`
+	Message    string        `json:",omitempty"`
+	Code       string        `json:",omitempty"`
+	Data       interface{}   `json:",omitempty"`
+	Summary    *EventSummary `json:",omitempty"`
+}
+
+// EventSummary is the outcome of a command run with -json.
+type EventSummary struct {
+	Status   int // exit status
+	Results  int // result events
+	Warnings int // warning events
+}
+
+// eventLog writes the events of one command. It is nil unless -json
+// was given.
+type eventLog struct {
+	mu       sync.Mutex
+	w        io.Writer
+	cmd      string
+	results  int
+	warnings int
+}
+
+var (
+	events *eventLog
+
+	// stdout is where commands write their usual output: os.Stdout,
+	// or output events with -json.
+	stdout io.Writer = os.Stdout
+)
+
+func (l *eventLog) emit(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Command = l.cmd
+	switch e.Type {
+	case "result":
+		l.results++
+	case "warning":
+		l.warnings++
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		b, _ = json.Marshal(Event{Type: "error", Command: l.cmd, Code: "internal", Message: err.Error()})
+	}
+	l.w.Write(append(b, '\n'))
+}
+
+func (l *eventLog) summary(status int) {
+	l.mu.Lock()
+	s := &EventSummary{Status: status, Results: l.results, Warnings: l.warnings}
+	l.mu.Unlock()
+	l.emit(Event{Type: "summary", Summary: s})
+}
+
+// startEvents makes the output of the command named cmd events written
+// to w, and returns a func undoing that.
+func startEvents(w io.Writer, cmd string) func() {
+	events = &eventLog{w: w, cmd: cmd}
+	stdout = lineEvents("output")
+	flags := log.Flags()
+	log.SetFlags(0)
+	log.SetOutput(logEvents{})
+	return func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+		events, stdout = nil, os.Stdout
+	}
+}
+
+// lineEvents is an io.Writer making each line written to it an event
+// of its type.
+type lineEvents string
+
+func (t lineEvents) Write(p []byte) (int, error) {
+	for _, l := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		events.emit(Event{Type: string(t), Message: l})
+	}
+	return len(p), nil
+}
+
+// logEvents is an io.Writer for the log package, making each message a
+// progress event, or a warning event if it starts with WARNING.
+type logEvents struct{}
+
+func (logEvents) Write(p []byte) (int, error) {
+	msg := strings.TrimPrefix(strings.TrimSuffix(string(p), "\n"), log.Prefix())
+	t := "progress"
+	if m := strings.TrimLeft(msg, "["); strings.HasPrefix(m, "WARNING") {
+		t = "warning"
+	}
+	return lineEvents(t).Write([]byte(msg))
+}
+
+// result reports the outcome action for a dependency, or for the
+// repository holding it, to events. Without -json it does nothing.
+func result(action, importPath, rev string, data interface{}) {
+	if events != nil {
+		events.emit(Event{Type: "result", Action: action, ImportPath: importPath, Rev: rev, Data: data})
+	}
+}
+
+// depResult reports the outcome action for the dependency d to
+// events. If err is not nil, the action failed, and the event has its
+// code and message. Without -json it does nothing.
+func depResult(action string, d Dependency, err error) {
+	if events == nil {
+		return
+	}
+	e := Event{Type: "result", Action: action, ImportPath: d.ImportPath, Rev: d.Rev}
+	if err != nil {
+		e.Code, e.Message = errorCode(err), err.Error()
+	}
+	events.emit(e)
+}
+
+// fatal reports the message made of a and exits with status 1, as
+// log.Fatalln does. With -json it writes an error event, with the code
+// of the last error in a, and the summary.
+func fatal(a ...interface{}) {
+	if events == nil {
+		log.Fatalln(a...)
+	}
+	code := "error"
+	for _, x := range a {
+		if err, ok := x.(error); ok {
+			code = errorCode(err)
+		}
+	}
+	msg := strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+	events.emit(Event{Type: "error", Code: code, Message: msg})
+	exit(1)
+}
+
+// fatalf is as fatal, with a message formatted as for fmt.Printf.
+func fatalf(format string, a ...interface{}) {
+	if events == nil {
+		log.Fatalf(format, a...)
+	}
+	fatal(strings.TrimSuffix(fmt.Sprintf(format, a...), "\n"))
+}
+
+// exit exits with status, after writing the summary with -json.
+func exit(status int) {
+	if events != nil {
+		events.summary(status)
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,70 @@
+package godep
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	var cases = []struct {
+		err  error
+		want string
+	}{
+		{errorLoadingDeps, "loading-deps"},
+		{errorPlanStale, "plan-stale"},
+		{errPackageNotFound{"D"}, "package-not-found"},
+		{errorMissingDep{"D", "C"}, "missing-dep"},
+		{&revError{"D", "D1", "E", "D2"}, "rev-conflict"},
+		{&os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, "not-exist"},
+		{errors.New("other"), "error"},
+	}
+	for i, c := range cases {
+		if got := errorCode(c.err); got != c.want {
+			t.Errorf("%d errorCode(%v) = %q want %q", i, c.err, got, c.want)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	var buf bytes.Buffer
+	end := startEvents(&buf, "save")
+	log.Println("saving")
+	log.Println("WARNING: deprecated")
+	fmt.Fprintln(stdout, "a\nb")
+	depResult("save", Dependency{ImportPath: "D", Rev: "D1"}, nil)
+	depResult("restore", Dependency{ImportPath: "E", Rev: "E1"}, errPackageNotFound{"E"})
+	events.summary(1)
+	end()
+
+	want := []Event{
+		{Type: "progress", Command: "save", Message: "saving"},
+		{Type: "warning", Command: "save", Message: "WARNING: deprecated"},
+		{Type: "output", Command: "save", Message: "a"},
+		{Type: "output", Command: "save", Message: "b"},
+		{Type: "result", Command: "save", Action: "save", ImportPath: "D", Rev: "D1"},
+		{Type: "result", Command: "save", Action: "restore", ImportPath: "E", Rev: "E1",
+			Code: "package-not-found", Message: "Package (E) not found"},
+		{Type: "summary", Command: "save", Summary: &EventSummary{Status: 1, Results: 2, Warnings: 1}},
+	}
+	var got []Event
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v want %+v", got, want)
+	}
+	if events != nil || stdout != os.Stdout {
+		t.Error("events not stopped")
+	}
+}
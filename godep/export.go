@@ -0,0 +1,361 @@
+package godep
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var cmdExport = &Command{
+	Name:  "export",
+	Args:  "-format=bazel | -template file",
+	Short: "print the dependencies in another tool's format",
+	Long: `
+Export prints the dependencies in Godeps.json, one entry per
+repository, in the format of another build tool.
+
+Formats:
+
+	bazel   a go_repository rule for each repository, with its
+	        importpath, commit and remote, in a Starlark macro
+	        named godep_repositories for use from a WORKSPACE file
+
+Rule names are derived from the repository's import path, the way
+Gazelle names them: github.com/foo/bar-baz becomes
+com_github_foo_bar_baz.
+
+The remote of a repository is the URL its copy in GOPATH fetches from,
+as reported by its VCS, so mirrors set up with git's url.insteadOf or
+by cloning from a mirror are kept. Repositories not in GOPATH get no
+remote, and Bazel resolves their import path instead.
+
+If -template is given, export instead executes the text/template in
+file on the dependencies and writes the result. The template is run on
+an ExportView:
+
+	type ExportView struct {
+		ImportPath string       // of the project
+		GoVersion  string
+		Deps       []ExportDep  // sorted by import path
+		Repos      []ExportRepo // sorted by root
+	}
+
+	type ExportDep struct {
+		ImportPath string
+		Root       string   // import path of the repository root
+		VCS        string   // git, hg or bzr; "" if not in GOPATH
+		URL        string   // remote of the repository, if known
+		Rev        string
+		Comment    string
+		License    string   // vendored license file, if any
+		Files      []string // vendored files, relative to the project
+	}
+
+	type ExportRepo struct {
+		Root, VCS, URL, Rev, Comment string
+		Deps []ExportDep
+	}
+
+Besides the standard template functions, templates can use trim,
+lower, upper, replace (as strings.Replace with n = -1), join (as
+strings.Join, list first), base (as path.Base), quote (as
+strconv.Quote), short (a revision's first 12 characters) and bazel
+(the Bazel name of an import path).
+
+The output depends only on Godeps.json, the vendored copies and the
+repositories in GOPATH, and is sorted, so it only changes when they do.
+`,
+	Run:          runExport,
+	OnlyInGOPATH: true,
+}
+
+var exportFormat, exportTemplate string
+
+func init() {
+	cmdExport.Flag.StringVar(&exportFormat, "format", "", "output format: bazel")
+	cmdExport.Flag.StringVar(&exportTemplate, "template", "", "text/template file to execute")
+}
+
+// ExportView is the data export -template runs a template on.
+type ExportView struct {
+	ImportPath string
+	GoVersion  string
+	Deps       []ExportDep
+	Repos      []ExportRepo
+}
+
+// ExportDep is one dependency, as exported.
+type ExportDep struct {
+	ImportPath string
+	Root       string
+	VCS        string
+	URL        string
+	Rev        string
+	Comment    string
+	License    string
+	Files      []string
+}
+
+// ExportRepo is one repository of the dependencies, as exported.
+type ExportRepo struct {
+	Root    string
+	VCS     string // "" if not in GOPATH
+	URL     string // "" if not known
+	Rev     string
+	Comment string
+	Deps    []ExportDep
+}
+
+// exportFuncs are the functions export templates can use.
+var exportFuncs = template.FuncMap{
+	"trim":    strings.TrimSpace,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(s, old, new string) string { return strings.Replace(s, old, new, -1) },
+	"join":    func(a []string, sep string) string { return strings.Join(a, sep) },
+	"base":    path.Base,
+	"quote":   strconv.Quote,
+	"short":   shortRev,
+	"bazel":   bazelName,
+}
+
+func runExport(cmd *Command, args []string) {
+	if len(args) > 0 {
+		cmd.UsageExit()
+	}
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		fatal(err)
+	}
+	ignoreImports = g.Ignore
+	if err := setBuildConfig(&g); err != nil {
+		fatal(err)
+	}
+	repos, err := exportRepos(newRepoSession(), g.Deps)
+	if err != nil {
+		fatal(err)
+	}
+	switch {
+	case exportTemplate != "" && exportFormat != "":
+		cmd.UsageExit()
+	case exportTemplate != "":
+		err = writeTemplate(stdout, exportTemplate, &ExportView{
+			ImportPath: g.ImportPath,
+			GoVersion:  g.GoVersion,
+			Deps:       exportDeps(repos),
+			Repos:      repos,
+		})
+	case exportFormat == "bazel":
+		err = writeBazel(stdout, repos)
+	case exportFormat == "":
+		cmd.UsageExit()
+	default:
+		err = fmt.Errorf("unknown export format %q", exportFormat)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// exportRepos groups deps by repository, sorted by root, and finds
+// what each has vendored.
+func exportRepos(s *repoSession, deps []Dependency) ([]ExportRepo, error) {
+	deps, err := fillDeps(s, append([]Dependency(nil), deps...))
+	if err != nil {
+		return nil, err
+	}
+	var repos []ExportRepo
+	byRoot := make(map[string]int)
+	for _, d := range deps {
+		if isIgnored(d.ImportPath) {
+			continue
+		}
+		root := depRepoRoot(d, deps)
+		i, ok := byRoot[root]
+		if !ok {
+			r := ExportRepo{Root: root, Rev: d.Rev, Comment: d.Comment}
+			if d.vcs != nil {
+				r.VCS = d.vcs.vcs.Cmd
+				repo, err := s.repo(d.dir, filepath.Join(d.ws, "src"))
+				if err != nil {
+					return nil, err
+				}
+				if r.URL, err = d.vcs.remote(repo.dir); err != nil {
+					verboseln("no remote for", root+":", err)
+				}
+			}
+			i = len(repos)
+			byRoot[root] = i
+			repos = append(repos, r)
+		}
+		r := &repos[i]
+		if d.Rev != r.Rev {
+			return nil, fmt.Errorf("packages of %s are at different revisions, %s and %s", root, shortRev(r.Rev), shortRev(d.Rev))
+		}
+		files, err := exportFiles(d, deps)
+		if err != nil {
+			return nil, err
+		}
+		r.Deps = append(r.Deps, ExportDep{
+			ImportPath: d.ImportPath,
+			Root:       root,
+			VCS:        r.VCS,
+			URL:        r.URL,
+			Rev:        d.Rev,
+			Comment:    d.Comment,
+			License:    exportLicense(d.ImportPath, root),
+			Files:      files,
+		})
+	}
+	sort.Sort(byRepoRoot(repos))
+	return repos, nil
+}
+
+// exportDeps returns the dependencies of repos, sorted by import path.
+func exportDeps(repos []ExportRepo) []ExportDep {
+	var deps []ExportDep
+	for _, r := range repos {
+		deps = append(deps, r.Deps...)
+	}
+	sort.Sort(byExportPath(deps))
+	return deps
+}
+
+// exportFiles returns the files vendored for d, slash separated and
+// relative to the project, leaving out the directories of the other
+// dependencies in all.
+func exportFiles(d Dependency, all []Dependency) ([]string, error) {
+	vendor := relativeVendorTarget(vendorExperiment)
+	dir := filepath.Join(vendor, filepath.FromSlash(d.ImportPath))
+	others := make(map[string]bool)
+	for _, o := range all {
+		if o.ImportPath != d.ImportPath {
+			others[filepath.Join(vendor, filepath.FromSlash(o.ImportPath))] = true
+		}
+	}
+	var files []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			if others[p] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, filepath.ToSlash(p))
+		return nil
+	})
+	return files, err
+}
+
+// exportLicense returns the license file vendored nearest to the
+// package importPath, in its directory or one above it up to root, or
+// "" if there is none.
+func exportLicense(importPath, root string) string {
+	vendor := relativeVendorTarget(vendorExperiment)
+	for ip := importPath; ; ip = path.Dir(ip) {
+		names, err := filepath.Glob(filepath.Join(vendor, filepath.FromSlash(ip), "*"))
+		if err == nil {
+			for _, n := range names {
+				if IsLicenseFile(filepath.Base(n)) {
+					return filepath.ToSlash(n)
+				}
+			}
+		}
+		if ip == root || !strings.Contains(ip, "/") {
+			return ""
+		}
+	}
+}
+
+// writeTemplate executes the template in file on v.
+func writeTemplate(w io.Writer, file string, v *ExportView) error {
+	t, err := template.New(filepath.Base(file)).Funcs(exportFuncs).ParseFiles(file)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, v)
+}
+
+// writeBazel writes a go_repository rule for each of repos.
+func writeBazel(w io.Writer, repos []ExportRepo) error {
+	names := make(map[string]string)
+	for _, r := range repos {
+		n := bazelName(r.Root)
+		if o, ok := names[n]; ok {
+			return fmt.Errorf("%s and %s both have the Bazel name %s", o, r.Root, n)
+		}
+		names[n] = r.Root
+	}
+	fmt.Fprintln(w, "# Code generated by godep export. DO NOT EDIT.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `load("@bazel_gazelle//:deps.bzl", "go_repository")`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "def godep_repositories():")
+	if len(repos) == 0 {
+		fmt.Fprintln(w, "    pass")
+	}
+	for i, r := range repos {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "    go_repository(")
+		fmt.Fprintf(w, "        name = %q,\n", bazelName(r.Root))
+		fmt.Fprintf(w, "        importpath = %q,\n", r.Root)
+		fmt.Fprintf(w, "        commit = %q,\n", r.Rev)
+		if r.URL != "" {
+			fmt.Fprintf(w, "        remote = %q,\n", r.URL)
+			fmt.Fprintf(w, "        vcs = %q,\n", r.VCS)
+		}
+		fmt.Fprintln(w, "    )")
+	}
+	return nil
+}
+
+// bazelName returns the Bazel repository name for the import path
+// importPath: the host name reversed, then the rest of the path, with
+// anything but letters and digits turned into underscores.
+//
+// For example,
+//
+//	bazelName(github.com/foo/bar-baz) = com_github_foo_bar_baz
+//	bazelName(gopkg.in/yaml.v2)       = in_gopkg_yaml_v2
+func bazelName(importPath string) string {
+	elems := strings.Split(strings.ToLower(importPath), "/")
+	host := strings.Split(elems[0], ".")
+	for i, j := 0, len(host)-1; i < j; i, j = i+1, j-1 {
+		host[i], host[j] = host[j], host[i]
+	}
+	name := strings.Join(append(host, elems[1:]...), "_")
+	return strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// byRepoRoot sorts repositories by root.
+type byRepoRoot []ExportRepo
+
+func (a byRepoRoot) Len() int           { return len(a) }
+func (a byRepoRoot) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byRepoRoot) Less(i, j int) bool { return a[i].Root < a[j].Root }
+
+// byExportPath sorts exported dependencies by import path.
+type byExportPath []ExportDep
+
+func (a byExportPath) Len() int           { return len(a) }
+func (a byExportPath) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byExportPath) Less(i, j int) bool { return a[i].ImportPath < a[j].ImportPath }
@@ -0,0 +1,148 @@
+package godep
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBazelName(t *testing.T) {
+	var cases = []struct {
+		importPath, want string
+	}{
+		{"github.com/foo/bar", "com_github_foo_bar"},
+		{"github.com/Foo/bar-baz", "com_github_foo_bar_baz"},
+		{"gopkg.in/yaml.v2", "in_gopkg_yaml_v2"},
+		{"golang.org/x/net", "org_golang_x_net"},
+		{"D", "d"},
+	}
+	for _, test := range cases {
+		if g := bazelName(test.importPath); g != test.want {
+			t.Errorf("bazelName(%q) = %q want %q", test.importPath, g, test.want)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	setGlobals(true)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"E",
+			"",
+			[]*node{
+				{"main.go", pkg("E"), nil},
+				{"+git", "E1", nil},
+			},
+		},
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D"), nil},
+				{"P/main.go", pkg("P"), nil},
+				{"+git", "D1", nil},
+			},
+		},
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main", "D", "D/P", "E"), nil},
+				{"Godeps/Godeps.json", godeps("C", "D", "D1", "D/P", "D1", "E", "E1"), nil},
+				{"vendor/D/main.go", pkg("D"), nil},
+				{"vendor/D/LICENSE", "license\n", nil},
+				{"vendor/D/P/main.go", pkg("P"), nil},
+				{"vendor/E/main.go", pkg("E"), nil},
+				{"+git", "", nil},
+			},
+		},
+	}}, "")
+	run(t, filepath.Join(wd, src, "D"), "git", "remote", "add", "origin", "https://mirror.example.com/D.git")
+	rev := run(t, filepath.Join(wd, src, "D"), "git", "rev-parse", "D1")[:40]
+	erev := run(t, filepath.Join(wd, src, "E"), "git", "rev-parse", "E1")[:40]
+	// E is not in GOPATH, so it has no remote.
+	if err := os.RemoveAll(filepath.Join(src, "E")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(filepath.Join(wd, src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	setGOPATH(filepath.Join(wd, gopath))
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(ioutil.Discard)
+	repos, err := exportRepos(newRepoSession(), g.Deps)
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeBazel(&buf, repos); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Code generated by godep export. DO NOT EDIT.
+
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+def godep_repositories():
+    go_repository(
+        name = "d",
+        importpath = "D",
+        commit = "` + rev + `",
+        remote = "https://mirror.example.com/D.git",
+        vcs = "git",
+    )
+
+    go_repository(
+        name = "e",
+        importpath = "E",
+        commit = "` + erev + `",
+    )
+`
+	if g := buf.String(); g != want {
+		t.Errorf("export = %s want %s", g, want)
+	}
+
+	tf := filepath.Join(wd, gopath, "deps.tmpl")
+	err = ioutil.WriteFile(tf, []byte(`{{.ImportPath}}
+{{range .Deps}}{{.ImportPath}} {{.Root}} {{.VCS}} {{.URL}} {{short .Rev}} {{.Comment}} {{.License}} {{join .Files ","}}
+{{end}}{{range .Repos}}{{bazel .Root}} {{len .Deps}}
+{{end}}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err = writeTemplate(&buf, tf, &ExportView{ImportPath: g.ImportPath, Deps: exportDeps(repos), Repos: repos})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `C
+D D git https://mirror.example.com/D.git ` + rev[:12] + ` D1 vendor/D/LICENSE vendor/D/LICENSE,vendor/D/main.go
+D/P D git https://mirror.example.com/D.git ` + rev[:12] + ` D1 vendor/D/LICENSE vendor/D/P/main.go
+E E   ` + erev[:12] + ` E1  vendor/E/main.go
+d 2
+e 1
+`
+	if g := buf.String(); g != want {
+		t.Errorf("export -template = %s want %s", g, want)
+	}
+}
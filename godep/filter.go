@@ -0,0 +1,145 @@
+package godep
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// projectFiles are the project's Include and Exclude patterns, set from
+// Godeps.json by setBuildConfig.
+var projectFiles fileRules
+
+// fileRules are glob patterns, as for path.Match, selecting the files
+// copied from a dependency. A pattern without a slash matches any
+// element of a file's path; one with a slash matches from the root of
+// the dependency's repository. A pattern that matches a directory
+// matches everything in it.
+type fileRules struct {
+	include []string // files to copy even if godep would skip them
+	exclude []string // files never to copy
+}
+
+// fileFilter decides which files of a dependency are copied.
+type fileFilter struct {
+	root  string      // repository root; patterns are relative to it
+	top   string      // directory being copied; fixed rules for directories apply below it, if set
+	rules []fileRules // dependency's rules, then the project's
+}
+
+func newFileFilter(dep *Dependency, root, top string) fileFilter {
+	return fileFilter{
+		root: root,
+		top:  top,
+		rules: []fileRules{
+			{include: dep.Include, exclude: dep.Exclude},
+			projectFiles,
+		},
+	}
+}
+
+// decide reports whether the file or directory at rel, a slash
+// separated path relative to the repository root, is copied. The first
+// rule matching it decides, trying excludes before includes; if none
+// does, the fixed rules do.
+func (f fileFilter) decide(rel string, fixed bool) bool {
+	for _, r := range f.rules {
+		for _, p := range r.exclude {
+			if matchFile(p, rel) {
+				return false
+			}
+		}
+		for _, p := range r.include {
+			if matchFile(p, rel) {
+				return true
+			}
+		}
+	}
+	return fixed
+}
+
+// hasIncludes reports whether any include pattern is in effect, in
+// which case no directory can be skipped as a whole.
+func (f fileFilter) hasIncludes() bool {
+	for _, r := range f.rules {
+		if len(r.include) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rel returns name relative to the repository root, with slashes.
+func (f fileFilter) rel(name string) string {
+	rel, err := filepath.Rel(f.root, name)
+	if err != nil {
+		return filepath.ToSlash(name)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// fixed reports whether godep copies the file or directory name
+// without any patterns. Only files directly in f.top are copied, less
+// _test.go files unless saveT is set; below f.top, directories whose
+// names start with '.' or '_', and testdata unless saveT is set, are
+// not walked at all. If f.top is not set, any file but a test file is.
+func (f fileFilter) fixed(name string, isDir bool) bool {
+	base := filepath.Base(name)
+	if isDir {
+		return f.top == "" || pathEqual(name, f.top) ||
+			!(base[0] == '.' || base[0] == '_' || (!saveT && base == "testdata"))
+	}
+	if !saveT && strings.HasSuffix(base, "_test.go") {
+		return false
+	}
+	return f.top == "" || pathEqual(filepath.Dir(name), f.top)
+}
+
+// copies reports whether copyPkgFile would copy the file name when
+// walking from f.top, or from f.root if f.top is not set, judging by
+// the file's path alone.
+func (f fileFilter) copies(name string) bool {
+	base := f.top
+	if base == "" {
+		base = f.root
+	}
+	if !hasFilePathPrefix(name, base) {
+		return false
+	}
+	var dirs []string
+	for d := filepath.Dir(name); ; d = filepath.Dir(d) {
+		dirs = append(dirs, d)
+		if pathEqual(d, base) || d == filepath.Dir(d) {
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		switch name := filepath.Base(d); {
+		case name == ".git" || name == ".hg" || name == ".bzr" || name == ".svn":
+			return false
+		case flattenVendor && name == "vendor":
+			return false
+		case f.hasIncludes():
+		case !f.fixed(d, true), !f.decide(f.rel(d), true):
+			return false
+		}
+	}
+	return f.decide(f.rel(name), f.fixed(name, false))
+}
+
+// matchFile reports whether pattern matches rel or a directory
+// containing it.
+func matchFile(pattern, rel string) bool {
+	elems := strings.Split(rel, "/")
+	for i := range elems {
+		s := elems[i]
+		if strings.Contains(pattern, "/") {
+			s = strings.Join(elems[:i+1], "/")
+		}
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
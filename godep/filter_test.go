@@ -0,0 +1,38 @@
+package godep
+
+import "testing"
+
+func TestFileFilter(t *testing.T) {
+	ff := fileFilter{
+		root: "/src/D",
+		top:  "/src/D/sub",
+		rules: []fileRules{
+			{include: []string{"examples/keep.go"}, exclude: []string{"*.pb"}},
+			{include: []string{"*.pb", "_asm", "*_test.go"}, exclude: []string{"examples", "big/*.dat"}},
+		},
+	}
+	var cases = []struct {
+		name string
+		want bool
+	}{
+		{"/src/D/sub/a.go", true},
+		{"/src/D/sub/a.pb", false},                // dependency exclude beats project include
+		{"/src/D/sub/examples/x.go", false},       // any path element
+		{"/src/D/examples/keep.go", true},         // dependency include beats project exclude
+		{"/src/D/sub/inner/x.go", false},          // fixed rule: not in top
+		{"/src/D/big/f.dat", false},               // pattern with a slash is rooted
+		{"/src/D/sub/big/f.dat", false},           // so does not match here; not in top
+		{"/src/D/sub/f.dat", true},                // fixed rule
+		{"/src/D/sub/_asm/a.s", true},             // include overrides fixed rule
+		{"/src/D/sub/_other/a.s", false},          // fixed rule
+		{"/src/D/sub/testdata/a", false},          // fixed rule
+		{"/src/D/sub/a_test.go", true},            // include overrides fixed rule
+		{"/src/D/sub/.hidden/examples.go", false}, // fixed rule
+	}
+	for _, test := range cases {
+		got := ff.decide(ff.rel(test.name), ff.fixed(test.name, false))
+		if got != test.want {
+			t.Errorf("%s copied = %v want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package godep
+
+import (
+	"errors"
+	"go/build"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	saveFlatten bool // save -flatten
+
+	// flattenVendor is set from Flatten in Godeps.json. When it is set,
+	// the vendor trees of dependencies are not copied, and the packages
+	// in them are vendored at the top level instead.
+	flattenVendor bool
+)
+
+// nestedTrees are where a dependency may keep copies of other
+// packages, relative to its repository root.
+var nestedTrees = []string{"vendor", "Godeps/_workspace/src"}
+
+// splitNested splits the import path of a package copied inside
+// another into the import path of the package holding the copy and the
+// import path of the package copied. For example,
+//
+//	splitNested(D/vendor/E)                = D, E
+//	splitNested(D/Godeps/_workspace/src/E) = D, E
+func splitNested(importPath string) (holder, pkg string, ok bool) {
+	i, n := -1, 0
+	for _, t := range nestedTrees {
+		if j := strings.LastIndex(importPath, "/"+t+"/"); j > i {
+			i, n = j, len(t)+2
+		}
+	}
+	if i < 0 {
+		return "", importPath, false
+	}
+	return importPath[:i], importPath[i+n:], true
+}
+
+// nestedRev returns the revision of the package copied at importPath,
+// as recorded in the Godeps.json of the package holding the copy or
+// of one of its parents.
+func nestedRev(importPath string) (rev, comment string, ok bool) {
+	holder, pkg, ok := splitNested(importPath)
+	if !ok {
+		return "", "", false
+	}
+	dir, err := findDirForPath(holder, nil)
+	if err != nil {
+		return "", "", false
+	}
+	for {
+		g, err := loadGodepsFile(filepath.Join(dir, godepsFile))
+		if err == nil {
+			for _, d := range g.Deps {
+				if d.ImportPath == pkg || strings.HasPrefix(pkg, d.ImportPath+"/") {
+					return d.Rev, d.Comment, true
+				}
+			}
+			return "", "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || isSrcDir(parent) {
+			return "", "", false
+		}
+		dir = parent
+	}
+}
+
+func isSrcDir(dir string) bool {
+	for _, src := range build.Default.SrcDirs() {
+		if pathEqual(dir, src) {
+			return true
+		}
+	}
+	return false
+}
+
+// hoistable returns the paths not found in GOPATH whose packages were
+// found in nested copies, and the rest of paths. nested maps import
+// paths to the nested copies seen by the scanner.
+func hoistable(paths []string, nested map[string][]string) (keep, hoist []string) {
+	for _, p := range paths {
+		if _, ok := nested[p]; ok {
+			if _, err := findDirForPath(p, nil); err != nil {
+				hoist = append(hoist, p)
+				continue
+			}
+		}
+		keep = append(keep, p)
+	}
+	return keep, hoist
+}
+
+// flatten vendors at the top level the packages in hoist, which exist
+// only as copies inside other dependencies, and checks that every copy
+// of a dependency nested in another was made at the revision vendored.
+// nested maps import paths to the nested copies seen by the scanner.
+func (g *Godeps) flatten(nested map[string][]string, hoist []string) error {
+	// Copies the scanner did not see, such as those in Godeps
+	// workspaces or under vendor with the vendor experiment off.
+	for _, d := range g.Deps {
+		if d.root == "" {
+			continue
+		}
+		for _, e := range g.Deps {
+			if containsPathPrefix([]string{d.root}, e.ImportPath) {
+				continue
+			}
+			for _, t := range nestedTrees {
+				q := path.Join(d.root, t, e.ImportPath)
+				if fi, err := os.Stat(filepath.Join(d.ws, "src", filepath.FromSlash(q))); err == nil && fi.IsDir() {
+					nested[e.ImportPath] = append(nested[e.ImportPath], q)
+				}
+			}
+		}
+	}
+
+	var names []string
+	for name := range nested {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ok := true
+	for _, name := range names {
+		copies := nested[name]
+		sort.Strings(copies)
+		copies = uniq(copies)
+		if containsString(hoist, name) {
+			d, err := hoistDep(name, copies)
+			if err != nil {
+				log.Println(err)
+				ok = false
+				continue
+			}
+			verboseln("Hoisting", d.vendored, "to", name)
+			g.Deps = append(g.Deps, d)
+			continue
+		}
+		var rev string
+		for _, d := range g.Deps {
+			if d.ImportPath == name {
+				rev = d.Rev
+			}
+		}
+		if rev == "" {
+			continue // not vendored, e.g. part of the project
+		}
+		for _, q := range copies {
+			qrev, _, known := nestedRev(q)
+			switch {
+			case !known:
+				verboseln("revision of", q, "unknown; vendoring", name, "at", rev)
+			case qrev != rev:
+				log.Printf("conflict: %s is at %s, but %s was vendored at %s\n", name, rev, q, qrev)
+				ok = false
+			default:
+				verboseln("Flattening", q, "into", name)
+			}
+		}
+	}
+	sort.Sort(byImportPath(g.Deps))
+	if !ok {
+		return errorFlattenConflicts
+	}
+	return nil
+}
+
+// hoistDep returns a dependency for name, copied from one of copies.
+// The copies must agree on the revision.
+func hoistDep(name string, copies []string) (Dependency, error) {
+	var d Dependency
+	for _, q := range copies {
+		rev, comment, known := nestedRev(q)
+		if !known {
+			continue
+		}
+		if d.vendored == "" {
+			d = Dependency{ImportPath: name, Rev: rev, Comment: comment, vendored: q}
+		} else if rev != d.Rev {
+			return d, errFlattenConflict{name, d.vendored, d.Rev, q, rev}
+		}
+	}
+	if d.vendored == "" {
+		return d, errFlattenUnknown{name, copies[0]}
+	}
+	ps, err := loadPackages(d.vendored)
+	if err != nil {
+		return d, err
+	}
+	if ps[0].Error.Err != "" {
+		return d, errors.New(ps[0].Error.Err)
+	}
+	d.dir = ps[0].Dir
+	d.ws = ps[0].Root
+	d.root = name
+	return d, nil
+}
@@ -1,7 +1,6 @@
-package main
+package godep
 
 import (
-	"log"
 	"os"
 	"os/exec"
 )
@@ -47,18 +46,18 @@ func runGet(cmd *Command, args []string) {
 
 	err := command("go", append(cmdArgs, args)...).Run()
 	if err != nil {
-		log.Fatalln(err)
+		fatal(err)
 	}
 
 	// group import paths by Godeps location
 	groups := make(map[string][]string)
-	ps, err := LoadPackages(args...)
+	ps, err := loadPackages(args...)
 	if err != nil {
-		log.Fatalln(err)
+		fatal(err)
 	}
 	for _, pkg := range ps {
 		if pkg.Error.Err != "" {
-			log.Fatalln(pkg.Error.Err)
+			fatal(pkg.Error.Err)
 		}
 		dir, _ := findInParents(pkg.Dir, "Godeps")
 		groups[dir] = append(groups[dir], pkg.ImportPath)
@@ -72,7 +71,7 @@ func runGet(cmd *Command, args []string) {
 			c.Dir = dir
 		}
 		if err := c.Run(); err != nil {
-			log.Fatalln(err)
+			fatal(err)
 		}
 	}
 }
@@ -0,0 +1,827 @@
+package godep
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gitReader answers VCS queries about git repositories by reading
+// the .git directory directly instead of running the git command.
+// It understands loose and packed refs, the index (versions 2-4),
+// and loose and packed objects.
+type gitReader struct{}
+
+func (gitReader) identify(dir string) (string, error) {
+	r, err := openGitRepo(dir)
+	if err != nil {
+		return "", err
+	}
+	return r.resolve("HEAD")
+}
+
+func (gitReader) root(dir string) (string, error) {
+	r, err := openGitRepo(dir)
+	if err != nil {
+		return "", err
+	}
+	return r.worktree, nil
+}
+
+// isDirty mirrors `git diff {rev}`: it reports whether any tracked file
+// in the working tree differs from rev. Untracked files are ignored.
+func (gitReader) isDirty(dir, rev string) bool {
+	r, err := openGitRepo(dir)
+	if err != nil {
+		return true
+	}
+	id, err := r.resolve(rev)
+	if err != nil {
+		return true
+	}
+	tree, err := r.commitTree(id)
+	if err != nil {
+		return true
+	}
+	idx, err := r.readIndex()
+	if err != nil {
+		return true
+	}
+	if len(tree) != len(idx.entries) {
+		return true
+	}
+	for _, e := range idx.entries {
+		te, ok := tree[e.path]
+		if !ok || te.mode != e.mode {
+			return true
+		}
+		if e.mode == gitModeLink {
+			// Submodule changes are not reported by git diff unless the
+			// recorded commit changes, which the index already tells us.
+			if te.hash != e.hash {
+				return true
+			}
+			continue
+		}
+		h, err := r.worktreeHash(e, idx.mtime)
+		if err != nil || h != te.hash {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles mirrors `git ls-files --full-name` run in dir, keeping only
+// the files directly inside dir.
+func (g gitReader) listFiles(dir string) vcsFiles {
+	return g.listAllFiles(dir).inDir(dir)
+}
+
+// listAllFiles returns every file in the index of the repository
+// containing dir.
+func (gitReader) listAllFiles(dir string) vcsFiles {
+	r, err := openGitRepo(dir)
+	if err != nil {
+		return nil
+	}
+	idx, err := r.readIndex()
+	if err != nil {
+		return nil
+	}
+	files := make(vcsFiles)
+	for _, e := range idx.entries {
+		path, err := filepath.Abs(filepath.Join(r.worktree, filepath.FromSlash(e.path)))
+		if err != nil {
+			panic(err) // this should not happen
+		}
+		files[path] = true
+	}
+	return files
+}
+
+func (gitReader) exists(dir, rev string) bool {
+	r, err := openGitRepo(dir)
+	if err != nil {
+		return false
+	}
+	_, err = r.resolve(rev)
+	return err == nil
+}
+
+const (
+	gitModeTree = 040000
+	gitModeLink = 0160000 // submodule (gitlink)
+	gitModeSym  = 0120000
+	gitModeExec = 0100755
+	gitModeFile = 0100644
+)
+
+// gitRepo is a git repository opened for reading.
+type gitRepo struct {
+	worktree string   // top level of the working tree
+	gitdir   string   // the .git directory of this working tree
+	common   string   // directory holding objects and refs (differs from gitdir for linked worktrees)
+	objdirs  []string // object directories, including alternates
+	packs    []*gitPack
+	cache    map[string]gitObject // decoded commits and trees
+}
+
+type gitObject struct {
+	typ  string
+	data []byte
+}
+
+// gitRepos caches opened repositories by working tree root.
+var gitRepos = make(map[string]*gitRepo)
+
+// openGitRepo opens the git repository containing dir.
+func openGitRepo(dir string) (*gitRepo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if r, ok := gitRepos[d]; ok {
+			return r, nil
+		}
+		fi, err := os.Stat(filepath.Join(d, ".git"))
+		if err == nil {
+			r, err := newGitRepo(d, fi.IsDir())
+			if err != nil {
+				return nil, err
+			}
+			gitRepos[d] = r
+			return r, nil
+		}
+		if isRoot(d) {
+			return nil, fmt.Errorf("not a git repository (or any parent): %s", dir)
+		}
+	}
+}
+
+func newGitRepo(worktree string, isDir bool) (*gitRepo, error) {
+	r := &gitRepo{
+		worktree: worktree,
+		gitdir:   filepath.Join(worktree, ".git"),
+		cache:    make(map[string]gitObject),
+	}
+	if !isDir {
+		// A file of the form "gitdir: <path>", used by worktrees and submodules.
+		b, err := ioutil.ReadFile(r.gitdir)
+		if err != nil {
+			return nil, err
+		}
+		s := strings.TrimSpace(string(b))
+		if !strings.HasPrefix(s, "gitdir: ") {
+			return nil, fmt.Errorf("invalid gitfile format: %s", r.gitdir)
+		}
+		r.gitdir = absRoot(worktree, strings.TrimPrefix(s, "gitdir: "))
+	}
+	r.common = r.gitdir
+	if b, err := ioutil.ReadFile(filepath.Join(r.gitdir, "commondir")); err == nil {
+		r.common = absRoot(r.gitdir, strings.TrimSpace(string(b)))
+	}
+	r.objdirs = gitObjectDirs(filepath.Join(r.common, "objects"), 0)
+	for _, od := range r.objdirs {
+		idxs, _ := filepath.Glob(filepath.Join(od, "pack", "pack-*.idx"))
+		for _, idx := range idxs {
+			p, err := openGitPack(idx)
+			if err != nil {
+				return nil, err
+			}
+			r.packs = append(r.packs, p)
+		}
+	}
+	return r, nil
+}
+
+// gitObjectDirs returns od followed by the object directories it borrows
+// from through objects/info/alternates.
+func gitObjectDirs(od string, depth int) []string {
+	dirs := []string{od}
+	b, err := ioutil.ReadFile(filepath.Join(od, "info", "alternates"))
+	if err != nil || depth > 5 {
+		return dirs
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		dirs = append(dirs, gitObjectDirs(absRoot(od, l), depth+1)...)
+	}
+	return dirs
+}
+
+// resolve returns the object id named by rev, which may be a full or
+// abbreviated object id or the name of a ref. Tags are not peeled.
+func (r *gitRepo) resolve(rev string) (string, error) {
+	if id, err := r.resolveRef(rev, 0); err == nil {
+		return id, nil
+	}
+	if len(rev) >= 4 && len(rev) <= 40 && isHex(rev) {
+		return r.findObject(strings.ToLower(rev))
+	}
+	return "", fmt.Errorf("unknown revision: %s", rev)
+}
+
+func (r *gitRepo) resolveRef(name string, depth int) (string, error) {
+	if depth > 10 {
+		return "", fmt.Errorf("ref loop resolving %s", name)
+	}
+	var candidates []string
+	if name == "HEAD" || strings.HasPrefix(name, "refs/") {
+		candidates = []string{name}
+	} else {
+		candidates = []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name, "refs/remotes/" + name, "refs/remotes/" + name + "/HEAD"}
+	}
+	for _, c := range candidates {
+		dir := r.common
+		if c == "HEAD" {
+			dir = r.gitdir
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(c)))
+		if err == nil {
+			s := strings.TrimSpace(string(b))
+			if strings.HasPrefix(s, "ref: ") {
+				return r.resolveRef(strings.TrimPrefix(s, "ref: "), depth+1)
+			}
+			if len(s) == 40 && isHex(s) {
+				return s, nil
+			}
+			continue
+		}
+		if id, ok := r.packedRefs()[c]; ok {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("unknown ref: %s", name)
+}
+
+// packedRefs returns the contents of the packed-refs file.
+func (r *gitRepo) packedRefs() map[string]string {
+	refs := make(map[string]string)
+	f, err := os.Open(filepath.Join(r.common, "packed-refs"))
+	if err != nil {
+		return refs
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := s.Text()
+		if l == "" || l[0] == '#' || l[0] == '^' {
+			continue
+		}
+		if f := strings.Fields(l); len(f) == 2 {
+			refs[f[1]] = f[0]
+		}
+	}
+	return refs
+}
+
+// findObject returns the full id of the unique object whose id starts with prefix.
+func (r *gitRepo) findObject(prefix string) (string, error) {
+	found := make(map[string]bool)
+	for _, od := range r.objdirs {
+		if len(prefix) == 40 {
+			if _, err := os.Stat(filepath.Join(od, prefix[:2], prefix[2:])); err == nil {
+				return prefix, nil
+			}
+			continue
+		}
+		names, _ := filepath.Glob(filepath.Join(od, prefix[:2], prefix[2:]+"*"))
+		for _, n := range names {
+			found[prefix[:2]+filepath.Base(n)] = true
+		}
+	}
+	for _, p := range r.packs {
+		for _, id := range p.find(prefix) {
+			found[id] = true
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("unknown revision: %s", prefix)
+	case 1:
+		for id := range found {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("ambiguous revision: %s", prefix)
+}
+
+// object reads and inflates the object with the given id.
+func (r *gitRepo) object(id string) (gitObject, error) {
+	if o, ok := r.cache[id]; ok {
+		return o, nil
+	}
+	o, err := r.readObject(id)
+	if err == nil && o.typ != "blob" {
+		r.cache[id] = o
+	}
+	return o, err
+}
+
+func (r *gitRepo) readObject(id string) (gitObject, error) {
+	for _, od := range r.objdirs {
+		f, err := os.Open(filepath.Join(od, id[:2], id[2:]))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		zr, err := zlib.NewReader(f)
+		if err != nil {
+			return gitObject{}, err
+		}
+		b, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return gitObject{}, err
+		}
+		i := bytes.IndexByte(b, 0)
+		if i < 0 {
+			return gitObject{}, fmt.Errorf("corrupt loose object %s", id)
+		}
+		hdr := strings.Fields(string(b[:i]))
+		if len(hdr) != 2 {
+			return gitObject{}, fmt.Errorf("corrupt loose object %s", id)
+		}
+		return gitObject{typ: hdr[0], data: b[i+1:]}, nil
+	}
+	raw, err := hex.DecodeString(id)
+	if err != nil {
+		return gitObject{}, err
+	}
+	for _, p := range r.packs {
+		if off, ok := p.offset(raw); ok {
+			return p.readAt(r, off)
+		}
+	}
+	return gitObject{}, fmt.Errorf("object not found: %s", id)
+}
+
+// peel follows annotated tags until it reaches an object of another type.
+func (r *gitRepo) peel(id string) (string, gitObject, error) {
+	for i := 0; i < 10; i++ {
+		o, err := r.object(id)
+		if err != nil || o.typ != "tag" {
+			return id, o, err
+		}
+		id = gitHeader(o.data, "object")
+	}
+	return "", gitObject{}, fmt.Errorf("tag chain too long: %s", id)
+}
+
+// gitHeader returns the value of the named header in a commit or tag.
+func gitHeader(data []byte, name string) string {
+	for _, l := range strings.Split(string(data), "\n") {
+		if l == "" {
+			break
+		}
+		if strings.HasPrefix(l, name+" ") {
+			return strings.TrimPrefix(l, name+" ")
+		}
+	}
+	return ""
+}
+
+type gitTreeEntry struct {
+	mode uint32
+	hash string
+}
+
+// commitTree returns every file in the tree of commit id, keyed by
+// slash-separated path.
+func (r *gitRepo) commitTree(id string) (map[string]gitTreeEntry, error) {
+	_, o, err := r.peel(id)
+	if err != nil {
+		return nil, err
+	}
+	if o.typ != "commit" {
+		return nil, fmt.Errorf("%s is a %s, not a commit", id, o.typ)
+	}
+	files := make(map[string]gitTreeEntry)
+	return files, r.walkTree(gitHeader(o.data, "tree"), "", files)
+}
+
+func (r *gitRepo) walkTree(id, prefix string, files map[string]gitTreeEntry) error {
+	o, err := r.object(id)
+	if err != nil {
+		return err
+	}
+	if o.typ != "tree" {
+		return fmt.Errorf("%s is a %s, not a tree", id, o.typ)
+	}
+	b := o.data
+	for len(b) > 0 {
+		sp := bytes.IndexByte(b, ' ')
+		nul := bytes.IndexByte(b, 0)
+		if sp < 0 || nul < sp || len(b) < nul+21 {
+			return fmt.Errorf("corrupt tree %s", id)
+		}
+		mode, err := strconv.ParseUint(string(b[:sp]), 8, 32)
+		if err != nil {
+			return err
+		}
+		name := prefix + string(b[sp+1:nul])
+		hash := hex.EncodeToString(b[nul+1 : nul+21])
+		b = b[nul+21:]
+		if mode == gitModeTree {
+			if err := r.walkTree(hash, name+"/", files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[name] = gitTreeEntry{mode: uint32(mode), hash: hash}
+	}
+	return nil
+}
+
+type gitIndexEntry struct {
+	path  string
+	mode  uint32
+	hash  string
+	size  uint32
+	msec  uint32
+	mnsec uint32
+}
+
+type gitIndex struct {
+	entries []gitIndexEntry
+	mtime   int64 // modification time of the index file, in nanoseconds
+}
+
+// readIndex parses the index of the working tree. Entries are sorted by
+// path. An unmerged path is returned once, with a mode that never
+// matches a tree.
+func (r *gitRepo) readIndex() (*gitIndex, error) {
+	name := filepath.Join(r.gitdir, "index")
+	fi, err := os.Stat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &gitIndex{}, nil
+		}
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 12 || string(b[:4]) != "DIRC" {
+		return nil, fmt.Errorf("corrupt index: %s", name)
+	}
+	ver := binary.BigEndian.Uint32(b[4:])
+	if ver < 2 || ver > 4 {
+		return nil, fmt.Errorf("unsupported index version %d: %s", ver, name)
+	}
+	n := int(binary.BigEndian.Uint32(b[8:]))
+	idx := &gitIndex{mtime: fi.ModTime().UnixNano()}
+	seen := make(map[string]bool)
+	p := b[12:]
+	var prev string
+	for i := 0; i < n; i++ {
+		if len(p) < 62 {
+			return nil, fmt.Errorf("corrupt index: %s", name)
+		}
+		e := gitIndexEntry{
+			msec:  binary.BigEndian.Uint32(p[8:]),
+			mnsec: binary.BigEndian.Uint32(p[12:]),
+			mode:  binary.BigEndian.Uint32(p[24:]),
+			size:  binary.BigEndian.Uint32(p[36:]),
+			hash:  hex.EncodeToString(p[40:60]),
+		}
+		flags := binary.BigEndian.Uint16(p[60:])
+		stage := (flags >> 12) & 3
+		hdr := 62
+		if flags&0x4000 != 0 { // extended flags, version 3+
+			hdr += 2
+		}
+		if len(p) < hdr {
+			return nil, fmt.Errorf("corrupt index: %s", name)
+		}
+		p = p[hdr:]
+		if ver == 4 {
+			strip, k := binary.Uvarint(p)
+			if k <= 0 || int(strip) > len(prev) {
+				return nil, fmt.Errorf("corrupt index: %s", name)
+			}
+			p = p[k:]
+			nul := bytes.IndexByte(p, 0)
+			if nul < 0 {
+				return nil, fmt.Errorf("corrupt index: %s", name)
+			}
+			e.path = prev[:len(prev)-int(strip)] + string(p[:nul])
+			p = p[nul+1:]
+		} else {
+			nul := bytes.IndexByte(p, 0)
+			if nul < 0 {
+				return nil, fmt.Errorf("corrupt index: %s", name)
+			}
+			e.path = string(p[:nul])
+			// Entries are padded with 1-8 NULs to a multiple of eight bytes.
+			l := hdr + nul
+			pad := 8 - l%8
+			if len(p) < nul+pad {
+				return nil, fmt.Errorf("corrupt index: %s", name)
+			}
+			p = p[nul+pad:]
+		}
+		prev = e.path
+		if seen[e.path] {
+			continue
+		}
+		seen[e.path] = true
+		if stage != 0 {
+			e.mode = 0
+		}
+		idx.entries = append(idx.entries, e)
+	}
+	return idx, nil
+}
+
+// worktreeHash returns the blob id of the working tree file for e. The
+// index's cached id is trusted when the file's size and modification time
+// match the index entry and the file was not modified after the index was
+// written.
+func (r *gitRepo) worktreeHash(e gitIndexEntry, indexTime int64) (string, error) {
+	name := filepath.Join(r.worktree, filepath.FromSlash(e.path))
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return "", err
+	}
+	mt := fi.ModTime()
+	if uint32(fi.Size()) == e.size && uint32(mt.Unix()) == e.msec && uint32(mt.Nanosecond()) == e.mnsec && mt.UnixNano() < indexTime {
+		if gitFileMode(fi) == e.mode {
+			return e.hash, nil
+		}
+		return "", errors.New("mode changed")
+	}
+	if gitFileMode(fi) != e.mode {
+		return "", errors.New("mode changed")
+	}
+	var data []byte
+	if fi.Mode()&os.ModeSymlink != 0 {
+		l, err := os.Readlink(name)
+		if err != nil {
+			return "", err
+		}
+		data = []byte(filepath.ToSlash(l))
+	} else {
+		data, err = ioutil.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+	}
+	return gitBlobHash(data), nil
+}
+
+func gitFileMode(fi os.FileInfo) uint32 {
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		return gitModeSym
+	case fi.Mode()&0111 != 0:
+		return gitModeExec
+	}
+	return gitModeFile
+}
+
+// gitBlobHash returns the object id git assigns to a blob holding data.
+func gitBlobHash(data []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// gitPack is a pack file and its version 2 index.
+type gitPack struct {
+	path    string
+	fanout  [256]uint32
+	ids     []byte // sorted 20-byte object ids
+	offsets []byte // 4-byte offsets, high bit selects an entry in large
+	large   []byte // 8-byte offsets
+}
+
+func openGitPack(idxPath string) (*gitPack, error) {
+	b, err := ioutil.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8+256*4 || string(b[:4]) != "\377tOc" || binary.BigEndian.Uint32(b[4:]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index: %s", idxPath)
+	}
+	p := &gitPack{path: strings.TrimSuffix(idxPath, ".idx") + ".pack"}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(b[8+4*i:])
+	}
+	n := int(p.fanout[255])
+	base := 8 + 256*4
+	if len(b) < base+n*28 {
+		return nil, fmt.Errorf("corrupt pack index: %s", idxPath)
+	}
+	p.ids = b[base : base+n*20]
+	base += n * 24 // skip the CRC table
+	p.offsets = b[base : base+n*4]
+	p.large = b[base+n*4:]
+	return p, nil
+}
+
+// offset returns the position of object id in the pack.
+func (p *gitPack) offset(id []byte) (int64, bool) {
+	lo := 0
+	if id[0] > 0 {
+		lo = int(p.fanout[id[0]-1])
+	}
+	hi := int(p.fanout[id[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.ids[(lo+i)*20:(lo+i+1)*20], id) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.ids[i*20:(i+1)*20], id) {
+		return 0, false
+	}
+	off := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if off&0x80000000 == 0 {
+		return int64(off), true
+	}
+	j := int(off&0x7fffffff) * 8
+	return int64(binary.BigEndian.Uint64(p.large[j:])), true
+}
+
+// find returns the ids of objects in the pack that start with the hex prefix.
+func (p *gitPack) find(prefix string) []string {
+	var ids []string
+	n := int(p.fanout[255])
+	for i := 0; i < n; i++ {
+		id := hex.EncodeToString(p.ids[i*20 : (i+1)*20])
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+var gitPackTypes = [...]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+// readAt reads the object stored at off, resolving deltas.
+func (p *gitPack) readAt(r *gitRepo, off int64) (gitObject, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return gitObject{}, err
+	}
+	defer f.Close()
+	return p.readEntry(r, f, off, 0)
+}
+
+func (p *gitPack) readEntry(r *gitRepo, f *os.File, off int64, depth int) (gitObject, error) {
+	if depth > 64 {
+		return gitObject{}, fmt.Errorf("delta chain too long in %s", p.path)
+	}
+	br := bufio.NewReader(io.NewSectionReader(f, off, 1<<62))
+	c, err := br.ReadByte()
+	if err != nil {
+		return gitObject{}, err
+	}
+	typ := (c >> 4) & 7
+	for c&0x80 != 0 { // the inflated size; zlib tells us the same
+		if c, err = br.ReadByte(); err != nil {
+			return gitObject{}, err
+		}
+	}
+	var base gitObject
+	switch typ {
+	case 1, 2, 3, 4:
+		data, err := inflate(br)
+		return gitObject{typ: gitPackTypes[typ], data: data}, err
+	case 6: // OFS_DELTA
+		c, err := br.ReadByte()
+		if err != nil {
+			return gitObject{}, err
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = br.ReadByte(); err != nil {
+				return gitObject{}, err
+			}
+			rel = (rel+1)<<7 | int64(c&0x7f)
+		}
+		base, err = p.readEntry(r, f, off-rel, depth+1)
+		if err != nil {
+			return gitObject{}, err
+		}
+	case 7: // REF_DELTA
+		var id [20]byte
+		if _, err := io.ReadFull(br, id[:]); err != nil {
+			return gitObject{}, err
+		}
+		base, err = r.object(hex.EncodeToString(id[:]))
+		if err != nil {
+			return gitObject{}, err
+		}
+	default:
+		return gitObject{}, fmt.Errorf("unknown object type %d in %s", typ, p.path)
+	}
+	delta, err := inflate(br)
+	if err != nil {
+		return gitObject{}, err
+	}
+	data, err := applyGitDelta(base.data, delta)
+	return gitObject{typ: base.typ, data: data}, err
+}
+
+func inflate(r io.Reader) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+var errGitDelta = errors.New("corrupt git delta")
+
+// applyGitDelta reconstructs an object from its base and a pack delta.
+func applyGitDelta(base, delta []byte) ([]byte, error) {
+	varint := func() (int, bool) {
+		var v, s uint
+		for len(delta) > 0 {
+			c := delta[0]
+			delta = delta[1:]
+			v |= uint(c&0x7f) << s
+			s += 7
+			if c&0x80 == 0 {
+				return int(v), true
+			}
+		}
+		return 0, false
+	}
+	srcSize, ok := varint()
+	if !ok || srcSize != len(base) {
+		return nil, errGitDelta
+	}
+	dstSize, ok := varint()
+	if !ok {
+		return nil, errGitDelta
+	}
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0: // copy from base
+			var off, size int
+			for i := uint(0); i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errGitDelta
+				}
+				if i < 4 {
+					off |= int(delta[0]) << (8 * i)
+				} else {
+					size |= int(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if off+size > len(base) {
+				return nil, errGitDelta
+			}
+			out = append(out, base[off:off+size]...)
+		case op != 0: // insert literal bytes
+			if int(op) > len(delta) {
+				return nil, errGitDelta
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errGitDelta
+		}
+	}
+	if len(out) != dstSize {
+		return nil, errGitDelta
+	}
+	return out, nil
+}
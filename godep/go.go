@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"fmt"
@@ -35,16 +35,16 @@ func runGo(cmd *Command, args []string) {
 		log.Printf("invalid subcommand: %q", "go get")
 		fmt.Fprintln(os.Stderr, "Use 'godep go install' instead.")
 		fmt.Fprintln(os.Stderr, "Run 'godep help go' for usage.")
-		os.Exit(2)
+		exit(2)
 	}
 	c := exec.Command("go", args...)
 	c.Env = append(envNoGopath(), "GOPATH="+gopath)
 	c.Stdin = os.Stdin
-	c.Stdout = os.Stdout
+	c.Stdout = stdout
 	c.Stderr = os.Stderr
 	err := c.Run()
 	if err != nil {
-		log.Fatalln("go", err)
+		fatal("go", err)
 	}
 }
 
@@ -54,10 +54,10 @@ func runGo(cmd *Command, args []string) {
 func prepareGopath() (gopath string) {
 	dir, isDir := findGodeps()
 	if dir == "" {
-		log.Fatalln("No Godeps found (or in any parent directory)")
+		fatal("No Godeps found (or in any parent directory)")
 	}
 	if !isDir {
-		log.Fatalln(strings.TrimSpace(needSource))
+		fatal(strings.TrimSpace(needSource))
 	}
 	return filepath.Join(dir, "Godeps", "_workspace")
 }
@@ -70,7 +70,7 @@ func prepareGopath() (gopath string) {
 func findGodeps() (dir string, isDir bool) {
 	wd, err := os.Getwd()
 	if err != nil {
-		log.Fatalln(err)
+		fatal(err)
 	}
 	return findInParents(wd, "Godeps")
 }
@@ -102,7 +102,7 @@ func findInParents(dir, name string) (container string, isDir bool) {
 			continue
 		}
 		if err != nil {
-			log.Fatalln(err)
+			fatal(err)
 		}
 		return dir, fi.IsDir()
 	}
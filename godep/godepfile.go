@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"encoding/json"
@@ -21,8 +21,16 @@ type Godeps struct {
 	GoVersion    string
 	GodepVersion string
 	Packages     []string `json:",omitempty"` // Arguments to save, if any.
+	Ignore       []string `json:",omitempty"` // Import path patterns never to vendor.
+	Tags         []string `json:",omitempty"` // Build tags taken to be set when scanning.
+	IgnoreTags   []string `json:",omitempty"` // Build tags taken to be unset when scanning.
+	Targets      []string `json:",omitempty"` // GOOS/GOARCH pairs to find dependencies for.
+	Flatten      bool     `json:",omitempty"` // Vendor trees of dependencies are hoisted to the top.
+	Include      []string `json:",omitempty"` // Glob patterns of dependency files to copy that godep would skip.
+	Exclude      []string `json:",omitempty"` // Glob patterns of dependency files never to copy.
 	Deps         []Dependency
 	isOldFile    bool
+	ignored      []string // packages left out because of Ignore, set by fill
 }
 
 func loadGodepsFile(path string) (Godeps, error) {
@@ -42,11 +50,11 @@ func loadGodepsFile(path string) (Godeps, error) {
 func loadDefaultGodepsFile() (Godeps, error) {
 	var g Godeps
 	var err error
-	g, err = loadGodepsFile(godepsFile)
+	g, err = loadGodepsFile(inProject(godepsFile))
 	if err != nil {
 		if os.IsNotExist(err) {
 			var err1 error
-			g, err1 = loadGodepsFile(oldGodepsFile)
+			g, err1 = loadGodepsFile(inProject(oldGodepsFile))
 			if err1 != nil {
 				if os.IsNotExist(err1) {
 					return g, err
@@ -61,11 +69,17 @@ func loadDefaultGodepsFile() (Godeps, error) {
 }
 
 // pkgs is the list of packages to read dependencies for
-func (g *Godeps) fill(pkgs []*Package, destImportPath string) error {
+func (g *Godeps) fill(s *repoSession, pkgs []*Package, destImportPath string) error {
 	debugln("fill", destImportPath)
 	ppln(pkgs)
 	var err1 error
 	var path, testImports []string
+	targets := make(map[string][]string) // import path => targets needing it
+	addTargets := func(p *Package) {
+		for ip, ts := range p.Targets {
+			targets[unqualify(ip)] = append(targets[unqualify(ip)], ts...)
+		}
+	}
 	dipp := []string{destImportPath}
 	for _, p := range pkgs {
 		if p.Standard {
@@ -81,8 +95,11 @@ func (g *Godeps) fill(pkgs []*Package, destImportPath string) error {
 		path = append(path, p.Deps...)
 		testImports = append(testImports, p.TestImports...)
 		testImports = append(testImports, p.XTestImports...)
+		g.ignored = append(g.ignored, p.Ignored...)
+		addTargets(p)
 	}
-	ps, err := LoadPackages(testImports...)
+	testImports = g.dropIgnored(testImports)
+	ps, err := loadPackages(testImports...)
 	if err != nil {
 		return err
 	}
@@ -97,14 +114,25 @@ func (g *Godeps) fill(pkgs []*Package, destImportPath string) error {
 		}
 		path = append(path, p.ImportPath)
 		path = append(path, p.Deps...)
+		g.ignored = append(g.ignored, p.Ignored...)
+		addTargets(p)
 	}
 	debugln("path", path)
+	nested := make(map[string][]string) // import path => nested copies
 	for i, p := range path {
 		path[i] = unqualify(p)
+		if path[i] != p {
+			nested[path[i]] = append(nested[path[i]], p)
+		}
+	}
+	path = uniq(g.dropIgnored(path))
+	g.ignored = uniq(g.ignored)
+	var hoist []string
+	if flattenVendor {
+		path, hoist = hoistable(path, nested)
 	}
-	path = uniq(path)
 	debugln("uniq, unqualify'd path", path)
-	ps, err = LoadPackages(path...)
+	ps, err = loadPackages(path...)
 	if err != nil {
 		return err
 	}
@@ -118,37 +146,57 @@ func (g *Godeps) fill(pkgs []*Package, destImportPath string) error {
 			debugln("standard or dest skipping", pkg.ImportPath)
 			continue
 		}
-		vcs, reporoot, err := VCSFromDir(pkg.Dir, filepath.Join(pkg.Root, "src"))
+		repo, err := s.repo(pkg.Dir, filepath.Join(pkg.Root, "src"))
 		if err != nil {
 			log.Println(err)
 			err1 = errorLoadingDeps
 			continue
 		}
-		id, err := vcs.identify(pkg.Dir)
+		id, err := repo.identify()
 		if err != nil {
 			log.Println(err)
 			err1 = errorLoadingDeps
 			continue
 		}
-		if vcs.isDirty(pkg.Dir, id) {
+		if repo.isDirty(id) {
 			log.Println("dirty working tree (please commit changes):", pkg.Dir)
 			err1 = errorLoadingDeps
 			continue
 		}
-		comment := vcs.describe(pkg.Dir, id)
+		comment := repo.describe(id)
 		g.Deps = append(g.Deps, Dependency{
 			ImportPath: pkg.ImportPath,
 			Rev:        id,
 			Comment:    comment,
+			Targets:    targetNames(targets[pkg.ImportPath]),
 			dir:        pkg.Dir,
 			ws:         pkg.Root,
-			root:       filepath.ToSlash(reporoot),
-			vcs:        vcs,
+			root:       repo.root,
+			vcs:        repo.vcs,
 		})
 	}
+	if flattenVendor {
+		if err := g.flatten(nested, hoist); err != nil {
+			return err
+		}
+	}
 	return err1
 }
 
+// dropIgnored returns the paths that are not ignored, recording the
+// others in g.ignored.
+func (g *Godeps) dropIgnored(paths []string) []string {
+	var keep []string
+	for _, p := range paths {
+		if isIgnored(unqualify(p)) {
+			g.ignored = append(g.ignored, unqualify(p))
+			continue
+		}
+		keep = append(keep, p)
+	}
+	return keep
+}
+
 func (g *Godeps) copy() *Godeps {
 	h := *g
 	h.Deps = make([]Dependency, len(g.Deps))
@@ -158,9 +206,9 @@ func (g *Godeps) copy() *Godeps {
 
 func (g *Godeps) file() string {
 	if g.isOldFile {
-		return oldGodepsFile
+		return inProject(oldGodepsFile)
 	}
-	return godepsFile
+	return inProject(godepsFile)
 }
 
 func (g *Godeps) save() (int64, error) {
@@ -0,0 +1,83 @@
+package godep
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+)
+
+// manifestsAt returns the Godeps.json of the project as of each of
+// refs, read from the project's repository. If only one ref is given,
+// the second manifest is the one in the working tree.
+func manifestsAt(s *repoSession, refs []string) (a, b *Godeps, err error) {
+	dot, err := loadPackages(".")
+	if err != nil {
+		return nil, nil, err
+	}
+	repo, err := s.repo(dot[0].Dir, filepath.Join(dot[0].Root, "src"))
+	if err != nil {
+		return nil, nil, err
+	}
+	rel, err := filepath.Rel(repo.dir, dot[0].Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	file := path.Join(filepath.ToSlash(rel), filepath.ToSlash(godepsFile))
+	if a, err = manifestAt(repo, file, refs[0]); err != nil {
+		return nil, nil, err
+	}
+	if len(refs) == 1 {
+		g, err := loadDefaultGodepsFile()
+		return a, &g, err
+	}
+	b, err = manifestAt(repo, file, refs[1])
+	return a, b, err
+}
+
+// manifestAt reads the Godeps.json at file, relative to the root of
+// repo, as of ref.
+func manifestAt(repo *repoState, file, ref string) (*Godeps, error) {
+	data, err := repo.vcs.cat(repo.dir, ref, file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s at %s: %v", file, ref, err)
+	}
+	g := new(Godeps)
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s at %s: %v", file, ref, err)
+	}
+	return g, nil
+}
+
+// addLogs sets the Log of each repository in dd whose revision changed
+// to the commits between the two revisions, as found in GOPATH.
+func (dd *DepsDiff) addLogs(s *repoSession) {
+	for i := range dd.Repos {
+		r := &dd.Repos[i]
+		var c *DepChange
+		for j := range r.Changed {
+			if r.Changed[j].Rev.Old != r.Changed[j].Rev.New {
+				c = &r.Changed[j]
+				break
+			}
+		}
+		if c == nil {
+			continue
+		}
+		ps, err := loadPackages(c.ImportPath)
+		if err != nil || ps[0].Error.Err != "" {
+			verboseln("no log for", r.Root+":", c.ImportPath, "is not in GOPATH")
+			continue
+		}
+		repo, err := s.repo(ps[0].Dir, filepath.Join(ps[0].Root, "src"))
+		if err != nil {
+			verboseln("no log for", r.Root+":", err)
+			continue
+		}
+		r.Log, err = repo.vcs.log(repo.dir, c.Rev.Old, c.Rev.New)
+		if err != nil {
+			log.Printf("no log for %s from %s to %s\n", r.Root, shortRev(c.Rev.Old), shortRev(c.Rev.New))
+		}
+	}
+}
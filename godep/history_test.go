@@ -0,0 +1,124 @@
+package godep
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestsAt(t *testing.T) {
+	var cases = []struct {
+		refs    []string
+		want    []DepChange
+		wantLog int // commits logged for D
+		werr    bool
+	}{
+		{ // 0 - two refs
+			refs:    []string{"C1", "C2"},
+			want:    []DepChange{{ImportPath: "D", Rev: DiffChange{"D1", "D3"}, Comment: &DiffChange{"D1", "D3"}}},
+			wantLog: 2,
+		},
+		{ // 1 - one ref, against the working tree
+			refs:    []string{"C2"},
+			want:    []DepChange{{ImportPath: "D", Rev: DiffChange{"D3", "D2"}, Comment: &DiffChange{"D3", "D2"}}},
+			wantLog: 0, // D2 is older than D3
+		},
+		{ // 2 - the same ref
+			refs: []string{"C1", "C1"},
+		},
+		{ // 3 - no such ref
+			refs: []string{"C9", "C1"},
+			werr: true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	setGlobals(true)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D") + decl("D1"), nil},
+				{"+git", "D1", nil},
+				{"main.go", pkg("D") + decl("D2"), nil},
+				{"+git", "D2", nil},
+				{"main.go", pkg("D") + decl("D3"), nil},
+				{"+git", "D3", nil},
+			},
+		},
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main", "D"), nil},
+				{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+				{"+git", "C1", nil},
+				{"Godeps/Godeps.json", godeps("C", "D", "D3"), nil},
+				{"+git", "C2", nil},
+				{"Godeps/Godeps.json", godeps("C", "D", "D2"), nil},
+			},
+		},
+	}}, "")
+	err = os.Chdir(filepath.Join(wd, src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	setGOPATH(filepath.Join(wd, gopath))
+	revs := make(map[string]string)
+	for _, tag := range []string{"D1", "D2", "D3"} {
+		revs[run(t, filepath.Join(wd, src, "D"), "git", "rev-parse", tag)[:40]] = tag
+	}
+
+	for pos, test := range cases {
+		clearPkgCache()
+		clearStatCache()
+		s := newRepoSession()
+		log.SetOutput(ioutil.Discard)
+		a, b, err := manifestsAt(s, test.refs)
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d manifestsAt err = %v want %v", pos, err, test.werr)
+		}
+		if err != nil {
+			continue
+		}
+		dd := diffDeps(a, b)
+		dd.addLogs(s)
+		var got []DepChange
+		var gotLog int
+		for _, r := range dd.Repos {
+			for _, c := range r.Changed {
+				c.Rev = DiffChange{revs[c.Rev.Old], revs[c.Rev.New]}
+				got = append(got, c)
+			}
+			gotLog += len(r.Log)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%d changed = %+v want %+v", pos, got, test.want)
+			continue
+		}
+		for i := range got {
+			g, w := got[i], test.want[i]
+			if g.ImportPath != w.ImportPath || g.Rev != w.Rev || *g.Comment != *w.Comment {
+				t.Errorf("%d changed = %+v want %+v", pos, g, w)
+			}
+		}
+		if gotLog != test.wantLog {
+			t.Errorf("%d log has %d commits want %d", pos, gotLog, test.wantLog)
+		}
+	}
+}
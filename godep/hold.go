@@ -0,0 +1,87 @@
+package godep
+
+import (
+	"log"
+	"path"
+)
+
+var cmdHold = &Command{
+	Name:  "hold",
+	Args:  "[-reason text] packages",
+	Short: "pin dependencies so update leaves them alone",
+	Long: `
+Hold marks the named dependency packages as held in Godeps.json.
+Update skips held packages, and every other package from the same
+repository, unless it is given -force.
+
+If -reason is given, it is recorded alongside the hold and printed
+whenever update skips the package.
+
+Packages may be given as patterns, as for update.
+`,
+	Run:          runHold,
+	OnlyInGOPATH: true,
+}
+
+var cmdUnhold = &Command{
+	Name:  "unhold",
+	Args:  "packages",
+	Short: "release dependencies pinned with hold",
+	Long: `
+Unhold clears the hold, and its reason, on the named dependency
+packages in Godeps.json.
+
+Packages may be given as patterns, as for update.
+`,
+	Run:          runUnhold,
+	OnlyInGOPATH: true,
+}
+
+var holdReason string
+
+func init() {
+	cmdHold.Flag.StringVar(&holdReason, "reason", "", "why the dependency is held")
+}
+
+func runHold(cmd *Command, args []string) {
+	if len(args) == 0 {
+		cmd.UsageExit()
+	}
+	if err := setHold(args, true, holdReason); err != nil {
+		fatal(err)
+	}
+}
+
+func runUnhold(cmd *Command, args []string) {
+	if len(args) == 0 {
+		cmd.UsageExit()
+	}
+	if err := setHold(args, false, ""); err != nil {
+		fatal(err)
+	}
+}
+
+// setHold sets Hold and Reason on every dependency matching one of pats.
+func setHold(pats []string, hold bool, reason string) error {
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return err
+	}
+	for _, pat := range pats {
+		f := matchPattern(path.Clean(pat))
+		var any bool
+		for i := range g.Deps {
+			if f(g.Deps[i].ImportPath) {
+				g.Deps[i].Hold = hold
+				g.Deps[i].Reason = reason
+				any = true
+				verboseln("hold", g.Deps[i].ImportPath, hold)
+			}
+		}
+		if !any {
+			log.Println("not in manifest:", pat)
+		}
+	}
+	_, err = g.save()
+	return err
+}
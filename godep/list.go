@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"errors"
@@ -6,24 +6,38 @@ import (
 	"go/build"
 	"go/parser"
 	"go/token"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-	"unicode"
 
 	pathpkg "path"
 )
 
 var (
-	gorootSrc            = filepath.Join(build.Default.GOROOT, "src")
-	ignoreTags           = []string{"appengine", "ignore"} //TODO: appengine is a special case for now: https://github.com/tools/godep/issues/353
-	versionMatch         = regexp.MustCompile(`\Ago\d+\.\d+\z`)
-	versionNegativeMatch = regexp.MustCompile(`\A\!go\d+\.\d+\z`)
+	gorootSrc    = filepath.Join(build.Default.GOROOT, "src")
+	ignoreTags   = defaultIgnoreTags
+	versionMatch = regexp.MustCompile(`\Ago\d+\.\d+\z`)
+
+	// ignoreImports holds the import path patterns of the project's
+	// Ignore list. Matching imports are neither resolved nor scanned.
+	ignoreImports []string
 )
 
+// isIgnored reports whether path matches a pattern in ignoreImports,
+// or in the Ignore list of the project configuration.
+func isIgnored(path string) bool {
+	for _, pat := range append(ignoreImports[:len(ignoreImports):len(ignoreImports)], projectConfig.Ignore...) {
+		if matchPattern(pat)(path) {
+			return true
+		}
+	}
+	return false
+}
+
 type errorMissingDep struct {
 	i, dir string // import, dir
 }
@@ -32,6 +46,8 @@ func (e errorMissingDep) Error() string {
 	return "Unable to find dependent package " + e.i + " in context of " + e.dir
 }
 
+func (e errorMissingDep) code() string { return "missing-dep" }
+
 // packageContext is used to track an import and which package imported it.
 type packageContext struct {
 	pkg *build.Package // package that imports the import
@@ -132,25 +148,52 @@ func listPackage(path string) (*Package, error) {
 	debugln("Looking For Package:", path, "in", dir)
 	ppln(lp)
 
+	for _, t := range scanTargets() {
+		if err := scanDeps(p, lp, t); err != nil {
+			return nil, err
+		}
+	}
+	p.Imports = uniq(p.Imports)
+	p.Deps = uniq(p.Deps)
+	p.Ignored = uniq(p.Ignored)
+	debugln("Done Looking For Package:", path, "in", dir)
+	ppln(p)
+	return p, nil
+}
+
+// scanDeps adds to p the dependencies of lp when built for t.
+func scanDeps(p *Package, lp *build.Package, t buildTarget) error {
+	debugln("Scanning", lp.ImportPath, "for target", t)
 	ds := depScanner{}
-	ds.Add(lp, lp.Imports...)
+	ds.Add(lp, t.imports(lp)...)
 	for ds.Continue() {
 		ip, i := ds.Next()
 
 		debugf("Processing import %s for %s\n", i, ip.Dir)
+		if ui := unqualify(i); isIgnored(ui) {
+			debugln("ignoring import", i)
+			p.Ignored = append(p.Ignored, ui)
+			continue
+		}
 		pdir, err := findDirForPath(i, ip)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		dp, err := fullPackageInDir(pdir)
 		if err != nil { // This really should happen in this context though
 			ppln(err)
-			return nil, errorMissingDep{i: i, dir: ip.Dir}
+			return errorMissingDep{i: i, dir: ip.Dir}
 		}
 		ppln(dp)
 		if !dp.Goroot {
 			// Don't bother adding packages in GOROOT to the dependency scanner, they don't import things from outside of it.
-			ds.Add(dp, dp.Imports...)
+			ds.Add(dp, t.imports(dp)...)
+			if t.goos != "" {
+				if p.Targets == nil {
+					p.Targets = make(map[string][]string)
+				}
+				p.Targets[dp.ImportPath] = append(p.Targets[dp.ImportPath], t.String())
+			}
 		}
 		debugln("lp:")
 		ppln(lp)
@@ -163,11 +206,7 @@ func listPackage(path string) (*Package, error) {
 		p.Deps = append(p.Deps, dp.ImportPath)
 		p.Dependencies = addDependency(p.Dependencies, dp)
 	}
-	p.Imports = uniq(p.Imports)
-	p.Deps = uniq(p.Deps)
-	debugln("Done Looking For Package:", path, "in", dir)
-	ppln(p)
-	return p, nil
+	return nil
 }
 
 func addDependency(deps []build.Package, d *build.Package) []build.Package {
@@ -187,8 +226,8 @@ func findDirForPath(path string, ip *build.Package) (string, error) {
 	if build.IsLocalImport(path) {
 		dir := path
 		if !filepath.IsAbs(dir) {
-			if abs, err := filepath.Abs(dir); err == nil {
-				// interpret relative to current directory
+			if abs, err := filepath.Abs(inProject(dir)); err == nil {
+				// interpret relative to the project directory
 				dir = abs
 			}
 		}
@@ -196,7 +235,7 @@ func findDirForPath(path string, ip *build.Package) (string, error) {
 	}
 
 	// We need to check to see if the import exists in vendor/ folders up the hierarchy of the importing package
-	if VendorExperiment && ip != nil {
+	if vendorExperiment && ip != nil {
 		debugln("resolving vendor posibilities:", ip.Dir, ip.Root)
 		cr := cleanPath(ip.Root)
 
@@ -231,6 +270,10 @@ var (
 	statCache = make(map[string]statEntry)
 )
 
+func clearPkgCache() {
+	pkgCache = make(map[string]*build.Package)
+}
+
 func clearStatCache() {
 	statCache = make(map[string]statEntry)
 }
@@ -266,11 +309,6 @@ func fillPackage(p *build.Package) error {
 		p.Root = filepath.Dir(p.SrcRoot)
 	}
 
-	var buildMatch = "+build "
-	var buildFieldSplit = func(r rune) bool {
-		return unicode.IsSpace(r) || r == ','
-	}
-
 	debugln("Filling package:", p.ImportPath, "from", p.Dir)
 	gofiles, err := filepath.Glob(filepath.Join(p.Dir, "*.go"))
 	if err != nil {
@@ -284,38 +322,28 @@ func fillPackage(p *build.Package) error {
 
 	var testImports []string
 	var imports []string
-NextFile:
+	var files []srcFile
 	for _, file := range gofiles {
 		debugln(file)
-		pf, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly|parser.ParseComments)
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		pf, err := parser.ParseFile(token.NewFileSet(), file, src, parser.ImportsOnly)
 		if err != nil {
 			return err
 		}
 		testFile := strings.HasSuffix(file, "_test.go")
 		fname := filepath.Base(file)
-		for _, c := range pf.Comments {
-			ct := c.Text()
-			if i := strings.Index(ct, buildMatch); i != -1 {
-				for _, t := range strings.FieldsFunc(ct[i+len(buildMatch):], buildFieldSplit) {
-					for _, tag := range ignoreTags {
-						if t == tag {
-							p.IgnoredGoFiles = append(p.IgnoredGoFiles, fname)
-							continue NextFile
-						}
-					}
-
-					if versionMatch.MatchString(t) && !isSameOrNewer(t, majorGoVersion) {
-						debugln("Adding", fname, "to ignored list because of version tag", t)
-						p.IgnoredGoFiles = append(p.IgnoredGoFiles, fname)
-						continue NextFile
-					}
-					if versionNegativeMatch.MatchString(t) && isSameOrNewer(t[1:], majorGoVersion) {
-						debugln("Adding", fname, "to ignored list because of version tag", t)
-						p.IgnoredGoFiles = append(p.IgnoredGoFiles, fname)
-						continue NextFile
-					}
-				}
-			}
+		sf := srcFile{name: fname}
+		sf.cons, err = headerConstraint(headerLines(src))
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		if sf.cons != nil && !anyTarget(sf.cons) {
+			debugln("Adding", fname, "to ignored list because of its build constraint")
+			p.IgnoredGoFiles = append(p.IgnoredGoFiles, fname)
+			continue
 		}
 		if testFile {
 			p.TestGoFiles = append(p.TestGoFiles, fname)
@@ -331,13 +359,18 @@ NextFile:
 				testImports = append(testImports, name)
 			} else {
 				imports = append(imports, name)
+				sf.imports = append(sf.imports, name)
 			}
 		}
+		if !testFile {
+			files = append(files, sf)
+		}
 	}
 	imports = uniq(imports)
 	testImports = uniq(testImports)
 	p.Imports = imports
 	p.TestImports = testImports
+	srcFiles[p.Dir] = files
 	return nil
 }
 
@@ -556,10 +589,16 @@ func matchPackagesInFS(pattern string) []string {
 	match := matchPattern(pattern)
 
 	var pkgs []string
-	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+	filepath.Walk(inProject(dir), func(path string, fi os.FileInfo, err error) error {
 		if err != nil || !fi.IsDir() {
 			return nil
 		}
+		if projectDir != "" {
+			// Local import paths are relative to the project.
+			if path, err = filepath.Rel(projectDir, path); err != nil {
+				return nil
+			}
+		}
 		if path == dir {
 			// filepath.Walk starts at dir and recurses. For the recursive case,
 			// the path is the result of filepath.Join, which calls filepath.Clean.
@@ -583,7 +622,7 @@ func matchPackagesInFS(pattern string) []string {
 		if !match(name) {
 			return nil
 		}
-		ap, err := filepath.Abs(path)
+		ap, err := filepath.Abs(inProject(path))
 		if err != nil {
 			return nil
 		}
@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"io/ioutil"
@@ -77,6 +77,8 @@ func TestIsSameOrNewer(t *testing.T) {
 		{`go1.5`, `go1.6`, true},
 		{`go1.7`, `go1.6`, false},
 		{`go1.6`, `devel-8f48efb`, true}, // devel versions are always never
+		{`go1.6`, `go`, false},
+		{`go1.x`, `go1.6`, false},
 	}
 
 	for _, test := range cases {
@@ -1,14 +1,18 @@
-package main
+package godep
 
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/kr/pretty"
 )
 
 func debugln(a ...interface{}) (int, error) {
 	if debug {
+		if events != nil {
+			return debugEvent(fmt.Sprintln(a...))
+		}
 		return fmt.Println(a...)
 	}
 	return 0, nil
@@ -22,6 +26,9 @@ func verboseln(a ...interface{}) {
 
 func debugf(format string, a ...interface{}) (int, error) {
 	if debug {
+		if events != nil {
+			return debugEvent(fmt.Sprintf(format, a...))
+		}
 		return fmt.Printf(format, a...)
 	}
 	return 0, nil
@@ -29,7 +36,18 @@ func debugf(format string, a ...interface{}) (int, error) {
 
 func ppln(a ...interface{}) (int, error) {
 	if debug {
+		if events != nil {
+			var s []string
+			for _, x := range a {
+				s = append(s, pretty.Sprintf("%v", x))
+			}
+			return debugEvent(strings.Join(s, " "))
+		}
 		return pretty.Println(a...)
 	}
 	return 0, nil
 }
+
+func debugEvent(msg string) (int, error) {
+	return lineEvents("debug").Write([]byte(msg))
+}
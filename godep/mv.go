@@ -0,0 +1,238 @@
+package godep
+
+import (
+	"bytes"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var cmdMv = &Command{
+	Name:  "mv",
+	Args:  "[-t] [-force] [-tags 'tag...'] [-ignoretags 'tag...'] [-targets 'os/arch...'] oldpath newpath",
+	Short: "move a dependency to a new import path",
+	Long: `
+Mv switches the project from the dependency packages at oldpath to the
+same packages at newpath, as when an upstream repository moves or is
+replaced by a fork.
+
+It rewrites the imports of oldpath, and of the packages under it, in
+the project's packages to newpath. It then saves, as 'godep save' with
+the packages of Godeps.json would, so the new packages, at the revision
+checked out in GOPATH, replace the old ones in Godeps.json and in the
+vendored source. Holds on the old packages are kept; their local
+patches and Include and Exclude patterns are dropped, with a warning.
+
+If the save fails, the rewritten files are put back as they were.
+
+Files excluded from the build by their build tags are not rewritten.
+Mv lists the packages with such files still importing oldpath, to be
+fixed by hand, or included with -tags.
+
+The -t, -force, -tags, -ignoretags and -targets flags are as for save.
+`,
+	Run:          runMv,
+	OnlyInGOPATH: true,
+}
+
+func init() {
+	cmdMv.Flag.BoolVar(&saveT, "t", false, "save test files")
+	cmdMv.Flag.BoolVar(&updateForce, "force", false, "remove vendored files of oldpath edited by hand")
+	addBuildFlags(&cmdMv.Flag)
+}
+
+func runMv(cmd *Command, args []string) {
+	if len(args) != 2 {
+		cmd.UsageExit()
+	}
+	if err := mv(args[0], args[1]); err != nil {
+		fatal(err)
+	}
+}
+
+// movePath returns importPath with the prefix old replaced by new,
+// keeping any qualification with the Godeps workspace, and whether
+// importPath had that prefix.
+func movePath(importPath, old, new string) (string, bool) {
+	u := unqualify(importPath)
+	if u != old && !strings.HasPrefix(u, old+"/") {
+		return importPath, false
+	}
+	return importPath[:len(importPath)-len(u)] + new + u[len(old):], true
+}
+
+// mv moves the dependencies at old to new, as described for the
+// command. If it fails, the project's files are left as they were.
+func mv(old, new string) (err error) {
+	old, new = path.Clean(old), path.Clean(new)
+	if err := recoverTxn(); err != nil {
+		return err
+	}
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return err
+	}
+	ignoreImports = g.Ignore
+	if err := setBuildConfig(&g); err != nil {
+		return err
+	}
+	moved := make(map[string]Dependency) // new import path => old dependency
+	for _, d := range g.Deps {
+		np, ok := movePath(d.ImportPath, old, new)
+		if !ok {
+			continue
+		}
+		if _, err := build.Import(np, "", build.FindOnly); err != nil {
+			return errPackageNotFound{np}
+		}
+		if len(d.Patches) > 0 || len(d.Include) > 0 || len(d.Exclude) > 0 {
+			log.Printf("WARNING: the patches and Include and Exclude patterns of %s are not moved to %s\n", d.ImportPath, np)
+		}
+		moved[np] = d
+	}
+	if len(moved) == 0 {
+		return errNoSuchDep(old)
+	}
+	if err := checkHosts([]Dependency{{ImportPath: new}}); err != nil {
+		return err
+	}
+
+	args := g.Packages
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	dp, err := dotPackage()
+	if err != nil {
+		return err
+	}
+	a, err := loadPackages(args...)
+	if err != nil {
+		return err
+	}
+	var qualified bool // the project's imports are rewritten, as by save -r
+	rw := func(p string) string {
+		qualified = qualified || unqualify(p) != p
+		np, _ := movePath(p, old, new)
+		return np
+	}
+	var saved []savedFile // the project's files before rewriting
+	defer func() {
+		if err != nil {
+			restoreFiles(saved)
+		}
+	}()
+	vendorDir := filepath.Join(dp.Dir, relativeVendorTarget(vendorExperiment))
+	for _, p := range projectPackages(dp.Dir, a) {
+		if hasFilePathPrefix(p.Dir, vendorDir) {
+			continue
+		}
+		var names []string
+		for _, files := range [][]string{p.GoFiles, p.CgoFiles, p.TestGoFiles, p.XTestGoFiles} {
+			names = append(names, files...)
+		}
+		for _, name := range names {
+			name = filepath.Join(p.Dir, name)
+			f, err := saveFile(name)
+			if err != nil {
+				return err
+			}
+			saved = append(saved, f)
+			if err := rewriteImports(name, rw); err != nil {
+				return err
+			}
+		}
+		excluded, err := filesImporting(p.Dir, p.IgnoredGoFiles, old)
+		if err != nil {
+			return err
+		}
+		if len(excluded) > 0 {
+			log.Printf("WARNING: %s still imports %s in files excluded by build tags: %s\n", p.ImportPath, old, strings.Join(excluded, " "))
+			result("excluded", p.ImportPath, "", excluded)
+		}
+	}
+
+	// Save copies the new packages and removes the old ones.
+	clearPkgCache()
+	clearStatCache()
+	defer setSaveFlags(saveT, !vendorExperiment && qualified, saveFlatten, updateForce)()
+	if err := save(g.Packages); err != nil {
+		return err
+	}
+	saved = nil // moved; keep the rewritten files whatever happens now
+
+	// Keep the holds.
+	g, err = loadDefaultGodepsFile()
+	if err != nil {
+		return err
+	}
+	var held bool
+	for i := range g.Deps {
+		d := &g.Deps[i]
+		if od, ok := moved[d.ImportPath]; ok && od.Hold {
+			d.Hold, d.Reason = od.Hold, od.Reason
+			held = true
+		}
+	}
+	if held {
+		_, err = g.save()
+	}
+	return err
+}
+
+// filesImporting returns the names of the Go files in dir that import
+// the package path or a package under it.
+func filesImporting(dir string, names []string, path string) ([]string, error) {
+	var a []string
+	for _, name := range names {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range f.Imports {
+			p, err := strconv.Unquote(s.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := movePath(p, path, path); ok {
+				a = append(a, name)
+				break
+			}
+		}
+	}
+	return a, nil
+}
+
+// A savedFile is the contents of a file before mv rewrote it.
+type savedFile struct {
+	name string
+	mode os.FileMode
+	data []byte
+}
+
+func saveFile(name string) (savedFile, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return savedFile{}, err
+	}
+	data, err := ioutil.ReadFile(name)
+	return savedFile{name, fi.Mode(), data}, err
+}
+
+// restoreFiles puts back the files in saved that have changed.
+func restoreFiles(saved []savedFile) {
+	for _, f := range saved {
+		if data, err := ioutil.ReadFile(f.name); err == nil && bytes.Equal(data, f.data) {
+			continue
+		}
+		verboseln("Restoring", f.name)
+		logErr(replaceFile(f.name, f.mode, f.data))
+	}
+}
@@ -0,0 +1,177 @@
+package godep
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMv(t *testing.T) {
+	var cases = []struct {
+		old, new string
+		start    []*node
+		want     []*node
+		wdeps    []Dependency // Rev ignored
+		werr     bool
+	}{
+		{ // 0 - move to a fork
+			old: "D",
+			new: "F",
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"P/main.go", pkg("P"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{"E", "", []*node{{"main.go", pkg("E"), nil}, {"+git", "E1", nil}}},
+				{
+					"F",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("F"), nil},
+						{"P/main.go", pkg("P") + decl("F"), nil},
+						{"+git", "F1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "D/P", "E"), nil},
+						{"x.go", pkgWithTags("main", "ignore", "D"), nil},
+						{"Godeps/Godeps.json", &Godeps{
+							ImportPath: "C",
+							Deps: []Dependency{
+								{ImportPath: "D", Comment: "D1", Hold: true, Reason: "pinned"},
+								{ImportPath: "D/P", Comment: "D1"},
+								{ImportPath: "E", Comment: "E1"},
+							},
+						}, nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"vendor/D/P/main.go", pkg("P"), nil},
+						{"vendor/E/main.go", pkg("E"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "E", "F", "F/P"), nil},
+				{"C/x.go", pkgWithTags("main", "ignore", "D"), nil},
+				{"C/vendor/D", "(absent)", nil},
+				{"C/vendor/F/main.go", pkg("D") + decl("F"), nil},
+				{"C/vendor/F/P/main.go", pkg("P") + decl("F"), nil},
+				{"C/vendor/E/main.go", pkg("E"), nil},
+			},
+			wdeps: []Dependency{
+				{ImportPath: "E", Comment: "E1"},
+				{ImportPath: "F", Comment: "F1", Hold: true, Reason: "pinned"},
+				{ImportPath: "F/P", Comment: "F1"},
+			},
+		},
+		{ // 1 - not a dependency
+			old: "G",
+			new: "F",
+			start: []*node{
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{"F", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "F1", nil}}},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "D"), nil},
+				{"C/vendor/D/main.go", pkg("D"), nil},
+			},
+			wdeps: []Dependency{{ImportPath: "D", Comment: "D1"}},
+			werr:  true,
+		},
+		{ // 2 - failed save puts the imports back
+			old: "D",
+			new: "F",
+			start: []*node{
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{"F", "", []*node{{"main.go", pkg("D"), nil}}}, // not in a repository
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "D"), nil},
+				{"C/vendor/D/main.go", pkg("D"), nil},
+				{"C/vendor/F", "(absent)", nil},
+			},
+			wdeps: []Dependency{{ImportPath: "D", Comment: "D1"}},
+			werr:  true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	for pos, test := range cases {
+		setGlobals(true)
+		err = os.RemoveAll(scratch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(scratch, "r1", "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		dir := filepath.Join(wd, src, "C")
+		err = os.Chdir(dir)
+		if err != nil {
+			panic(err)
+		}
+		setGOPATH(filepath.Join(wd, scratch, "r1"))
+		err = mv(test.old, test.new)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d mv err = %v want %v", pos, err, test.werr)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		checkTree(t, pos, &node{src, "", test.want})
+
+		f, err := os.Open(filepath.Join(dir, "Godeps/Godeps.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var g Godeps
+		err = json.NewDecoder(f).Decode(&g)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range g.Deps {
+			g.Deps[i].Rev = ""
+		}
+		if !reflect.DeepEqual(g.Deps, test.wdeps) {
+			t.Errorf("%d Deps = %+v want %+v", pos, g.Deps, test.wdeps)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package godep
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Options are the settings a command or API call runs with. The zero
+// value runs in the current directory, with the settings the godep
+// command would pick there.
+//
+// Calls are serialized process-wide: one waits for any other in
+// progress, in any goroutine, to return, since they share godep's
+// package state.
+type Options struct {
+	// Dir is the directory of the project; "" is the current
+	// directory. API calls resolve the project's files against it
+	// and leave the working directory alone; Exec, which takes over
+	// the process, runs the command with Dir as its working
+	// directory.
+	Dir string
+
+	// GoVersion is the major version of Go to act for, as go1.7;
+	// "" is the version of the go command in PATH.
+	GoVersion string
+
+	// Vendor is where dependencies are copied: "vendor" for the
+	// vendor directory, "workspace" for Godeps/_workspace, or ""
+	// for the Vendor setting of Godeps/config.json, if any, or else
+	// to choose as the go command of GoVersion would.
+	Vendor string
+
+	Verbose bool // log what is done
+	Debug   bool // log internal state, too
+	GitLib  bool // read git repositories directly instead of running git
+
+	// Used by Save and Update.
+	Tests   bool // save: include test dependencies
+	Rewrite bool // save: rewrite import paths to the Godeps workspace
+	Flatten bool // save: hoist nested vendor trees to the top level
+	Force   bool // overwrite vendored files edited by hand; update held dependencies
+
+	// JSON makes Exec write the command's output as newline-delimited
+	// JSON events, as described by Event, to standard output. Only
+	// Exec uses it.
+	JSON bool
+}
+
+var (
+	// callMu serializes calls, which share godep's package state.
+	callMu sync.Mutex
+
+	// projectDir is the absolute Dir of the call in progress, or ""
+	// for the current directory.
+	projectDir string
+)
+
+// inProject returns name, a path relative to the project directory,
+// as one that resolves there from the working directory.
+func inProject(name string) string {
+	if projectDir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(projectDir, name)
+}
+
+// begin sets up godep's state for a call with o. The returned end
+// func undoes it, and must be called before another call begins.
+func (o *Options) begin() (end func(), err error) {
+	callMu.Lock()
+	done := func() {
+		projectDir = ""
+		callMu.Unlock()
+	}
+	defer func() {
+		if err != nil {
+			done()
+		}
+	}()
+	if o.Dir != "" {
+		if projectDir, err = filepath.Abs(o.Dir); err != nil {
+			return nil, err
+		}
+		var fi os.FileInfo
+		if fi, err = os.Stat(projectDir); err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", o.Dir)
+		}
+	}
+	v := o.GoVersion
+	if v == "" {
+		if v, err = goVersion(); err != nil {
+			return nil, err
+		}
+	}
+	majorGoVersion = v
+	if projectConfig, err = ReadConfig(inProject(configFile)); err != nil {
+		projectConfig = &Config{}
+		return nil, err
+	}
+	vendor := o.Vendor
+	if vendor == "" {
+		vendor = projectConfig.Vendor
+	}
+	switch vendor {
+	case "":
+		vendorExperiment = determineVendor(v)
+	case "vendor":
+		vendorExperiment = true
+	case "workspace":
+		vendorExperiment = false
+	default:
+		return nil, fmt.Errorf("unknown Vendor setting %q", vendor)
+	}
+	// sep is the signature set of path elements that
+	// precede the original path of an imported package.
+	sep = defaultSep(vendorExperiment)
+	verbose, debug = o.Verbose, o.Debug
+	useGitLib(o.GitLib)
+	clearPkgCache()
+	clearStatCache()
+	gitRepos = make(map[string]*gitRepo)
+	return done, nil
+}
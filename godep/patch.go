@@ -0,0 +1,663 @@
+package godep
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	pathpkg "path"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+var cmdPatch = &Command{
+	Name:  "patch",
+	Args:  "create [-name name] package",
+	Short: "record local changes to a vendored dependency",
+	Long: `
+Patch manages local patches that are applied on top of vendored
+dependencies. Patches live in Godeps/patches/<repo root>/ and are
+applied in name order every time save or update copies code from
+that repository. The patches applied to each dependency are recorded
+in its Patches field in Godeps.json.
+
+Patch create compares the vendored copy of the repository containing
+package with the source in GOPATH (at the recorded revision, with
+existing patches applied) and saves the difference as a new patch.
+
+If -name is given, it is used in the patch file name.
+
+If a patch no longer applies after an update, the dependency is
+copied without it and the patch is reported as a conflict.
+`,
+	Run:          runPatch,
+	OnlyInGOPATH: true,
+}
+
+var patchName string
+
+func init() {
+	cmdPatch.Flag.StringVar(&patchName, "name", "local", "name of the new patch")
+}
+
+var patchDir = filepath.Join("Godeps", "patches")
+
+func runPatch(cmd *Command, args []string) {
+	if len(args) == 0 || args[0] != "create" {
+		cmd.UsageExit()
+	}
+	// Allow flags after the subcommand as well.
+	cmd.Flag.Parse(args[1:])
+	args = cmd.Flag.Args()
+	if len(args) != 1 {
+		cmd.UsageExit()
+	}
+	name, err := createPatch(args[0], patchName)
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Fprintln(stdout, name)
+}
+
+// createPatch saves the vendored changes to the repository containing
+// pkg as a new patch and returns its file name.
+func createPatch(pkg, name string) (string, error) {
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return "", err
+	}
+	flattenVendor = g.Flatten
+	projectFiles = fileRules{include: g.Include, exclude: g.Exclude}
+	var deps []Dependency
+	for _, d := range g.Deps {
+		if d.ImportPath == pkg || strings.HasPrefix(d.ImportPath, pkg+"/") || strings.HasPrefix(pkg, d.ImportPath+"/") {
+			deps = append(deps, d)
+		}
+	}
+	if len(deps) == 0 {
+		return "", errors.New("not in manifest: " + pkg)
+	}
+	rs := newRepoSession()
+	deps, err = fillDeps(rs, deps[:1])
+	if err != nil {
+		return "", err
+	}
+	if deps[0].missing {
+		return "", errPackageNotFound{deps[0].ImportPath}
+	}
+	root := deps[0].root
+
+	// Every package vendored from the repository takes part.
+	deps = nil
+	for _, d := range g.Deps {
+		if containsPathPrefix([]string{root}, d.ImportPath) {
+			deps = append(deps, d)
+		}
+	}
+	deps, err = fillDeps(rs, deps)
+	if err != nil {
+		return "", err
+	}
+	for _, d := range deps {
+		if d.missing {
+			return "", errPackageNotFound{d.ImportPath}
+		}
+		repo, err := rs.repo(d.dir, filepath.Join(d.ws, "src"))
+		if err != nil {
+			return "", err
+		}
+		id, err := repo.identify()
+		if err != nil {
+			return "", err
+		}
+		if id != d.Rev {
+			return "", fmt.Errorf("%s is at revision %s in GOPATH, but the manifest wants %s; run 'godep restore' first", d.ImportPath, id, d.Rev)
+		}
+	}
+
+	tmp, err := ioutil.TempDir("", "godep-patch")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := copySrc(rs, tmp, deps); err != nil {
+		return "", err
+	}
+	pristine := filepath.Join(tmp, filepath.FromSlash(root))
+	names, err := patchesFor(root)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range names {
+		if err := applyPatch(pristine, filepath.Join(patchDir, filepath.FromSlash(root), n), nil); err != nil {
+			return "", errPatchConflict{root: root, patch: n, err: err}
+		}
+	}
+
+	var buf bytes.Buffer
+	vendored := filepath.Join(relativeVendorTarget(vendorExperiment), filepath.FromSlash(root))
+	if err := diffTrees(&buf, pristine, vendored); err != nil {
+		return "", err
+	}
+	if buf.Len() == 0 {
+		return "", errors.New("no local changes in " + vendored)
+	}
+
+	file := fmt.Sprintf("%04d-%s.patch", len(names)+1, name)
+	if err := writeFile(filepath.Join(patchDir, filepath.FromSlash(root), file), buf.String()); err != nil {
+		return "", err
+	}
+	names = append(names, file)
+	for i := range g.Deps {
+		if containsPathPrefix([]string{root}, g.Deps[i].ImportPath) {
+			g.Deps[i].Patches = names
+		}
+	}
+	_, err = g.save()
+	return file, err
+}
+
+// patchesFor returns the names of the patches for the repository
+// with import path root, in the order they are applied.
+func patchesFor(root string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(patchDir, filepath.FromSlash(root), "*.patch"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// applyPatches applies the local patches of each repository in deps to
+// the copy of it under srcdir. It returns the patches applied, keyed by
+// repo root; a repository without patches maps to nil. Patches that fail
+// to apply are logged and skipped, and errorPatchConflicts is returned.
+func applyPatches(srcdir string, deps []Dependency) (map[string][]string, error) {
+	applied := make(map[string][]string)
+	var err1 error
+	for _, dep := range deps {
+		if _, ok := applied[dep.root]; ok {
+			continue
+		}
+		applied[dep.root] = nil
+		names, err := patchesFor(dep.root)
+		if err != nil {
+			return nil, err
+		}
+		fresh := freshFiles(dep.root, deps)
+		for _, n := range names {
+			verboseln("Applying patch", n, "to", dep.root)
+			err := applyPatch(filepath.Join(srcdir, filepath.FromSlash(dep.root)), inProject(filepath.Join(patchDir, filepath.FromSlash(dep.root), n)), fresh)
+			if err != nil {
+				log.Println("CONFLICT:", errPatchConflict{root: dep.root, patch: n, err: err})
+				err1 = errorPatchConflicts
+				continue
+			}
+			applied[dep.root] = append(applied[dep.root], n)
+		}
+	}
+	return applied, err1
+}
+
+// freshFiles returns a filter selecting the files of repository root that
+// copySrc just copied for deps: those in the directory of a package in deps,
+// and legal files at the root. Other files were vendored, and patched,
+// by an earlier run.
+func freshFiles(root string, deps []Dependency) func(name string) bool {
+	dirs := make(map[string]bool)
+	for _, d := range deps {
+		if containsPathPrefix([]string{root}, d.ImportPath) {
+			dirs[strings.TrimPrefix(strings.TrimPrefix(d.ImportPath, root), "/")] = true
+		}
+	}
+	return func(name string) bool {
+		dir, file := pathpkg.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+		return dirs[dir] || (dir == "" && IsLegalFile(file))
+	}
+}
+
+// setPatches records the patches applied to each repository in deps.
+func setPatches(deps []Dependency, applied map[string][]string) {
+	for i := range deps {
+		if p, ok := applied[deps[i].root]; ok {
+			deps[i].Patches = p
+		}
+	}
+}
+
+// filePatch is the part of a unified diff that changes one file.
+type filePatch struct {
+	oldName, newName string // "" for /dev/null
+	hunks            []hunk
+}
+
+type hunk struct {
+	oldStart int      // line number of the first old line, as in the @@ header
+	old, new []string // lines, including their line terminators
+}
+
+// parsePatch parses a unified diff. Leading path elements such as
+// a/ and b/ are stripped from file names, as with patch -p1.
+func parsePatch(data []byte) ([]filePatch, error) {
+	lines := splitLines(data)
+	var fps []filePatch
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "--- ") {
+			continue
+		}
+		if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+			return nil, fmt.Errorf("line %d: missing +++ header", i+2)
+		}
+		fp := filePatch{
+			oldName: patchFileName(lines[i][4:]),
+			newName: patchFileName(lines[i+1][4:]),
+		}
+		for _, name := range []string{fp.oldName, fp.newName} {
+			if name != "" && !isLocalPatchName(name) {
+				return nil, fmt.Errorf("line %d: file %s is outside the repository", i+1, name)
+			}
+		}
+		i += 2
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@ ") {
+			var h hunk
+			var oldLen, newLen int
+			var err error
+			h.oldStart, oldLen, newLen, err = parseHunkHeader(lines[i])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			i++
+			var last *string
+			for (len(h.old) < oldLen || len(h.new) < newLen) && i < len(lines) {
+				l := lines[i]
+				i++
+				switch {
+				case l == "\n":
+					l = " \n"
+					fallthrough
+				case l[0] == ' ':
+					h.old = append(h.old, l[1:])
+					h.new = append(h.new, l[1:])
+					last = &h.new[len(h.new)-1]
+				case l[0] == '-':
+					h.old = append(h.old, l[1:])
+					last = &h.old[len(h.old)-1]
+				case l[0] == '+':
+					h.new = append(h.new, l[1:])
+					last = &h.new[len(h.new)-1]
+				default:
+					return nil, fmt.Errorf("line %d: unexpected line in hunk", i)
+				}
+				if i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+					// "\ No newline at end of file" applies to the previous line.
+					*last = strings.TrimSuffix(*last, "\n")
+					if l[0] == ' ' {
+						h.old[len(h.old)-1] = *last
+					}
+					i++
+				}
+			}
+			if len(h.old) != oldLen || len(h.new) != newLen {
+				return nil, fmt.Errorf("line %d: truncated hunk", i)
+			}
+			fp.hunks = append(fp.hunks, h)
+		}
+		i--
+		fps = append(fps, fp)
+	}
+	return fps, nil
+}
+
+// isLocalPatchName reports whether the slash-separated file name
+// from a patch header names a file within the patched directory.
+func isLocalPatchName(name string) bool {
+	if pathpkg.IsAbs(name) || filepath.VolumeName(filepath.FromSlash(name)) != "" {
+		return false
+	}
+	name = pathpkg.Clean(name)
+	return name != ".." && !strings.HasPrefix(name, "../")
+}
+
+func patchFileName(s string) string {
+	s = strings.TrimRight(s, "\r\n")
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i] // drop timestamps
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
+
+// parseHunkHeader parses "@@ -l,s +l,s @@".
+func parseHunkHeader(l string) (oldStart, oldLen, newLen int, err error) {
+	f := strings.Fields(l)
+	if len(f) < 4 || f[0] != "@@" || f[3] != "@@" || f[1][0] != '-' || f[2][0] != '+' {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header %q", strings.TrimSpace(l))
+	}
+	oldStart, oldLen, err = parseRange(f[1][1:])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	_, newLen, err = parseRange(f[2][1:])
+	return oldStart, oldLen, newLen, err
+}
+
+func parseRange(s string) (start, n int, err error) {
+	n = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if n, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	start, err = strconv.Atoi(s)
+	return start, n, err
+}
+
+// reverse returns the patch that undoes fp.
+func (fp filePatch) reverse() filePatch {
+	r := filePatch{oldName: fp.newName, newName: fp.oldName}
+	offset := 0
+	for _, h := range fp.hunks {
+		// Old line numbers of the reversed patch are new line numbers
+		// of fp, which shift by the lines each earlier hunk added.
+		start := h.oldStart + offset
+		if len(h.old) == 0 {
+			start++
+		}
+		if len(h.new) == 0 {
+			start--
+		}
+		r.hunks = append(r.hunks, hunk{oldStart: start, old: h.new, new: h.old})
+		offset += len(h.new) - len(h.old)
+	}
+	return r
+}
+
+// apply applies fp to the file content old. exists reports whether the
+// file exists at all.
+func (fp filePatch) apply(old []byte, exists bool) ([]byte, error) {
+	switch {
+	case fp.oldName == "" && exists:
+		return nil, errors.New("file already exists")
+	case fp.oldName != "" && !exists:
+		return nil, errors.New("file does not exist")
+	}
+	lines := splitLines(old)
+	var out []string
+	pos := 0
+	for _, h := range fp.hunks {
+		want := h.oldStart - 1
+		if len(h.old) == 0 {
+			want = h.oldStart
+		}
+		at := findLines(lines, h.old, want, pos)
+		if at < 0 {
+			return nil, fmt.Errorf("hunk at line %d does not apply", h.oldStart)
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, h.new...)
+		pos = at + len(h.old)
+	}
+	out = append(out, lines[pos:]...)
+	if fp.newName == "" && len(out) != 0 {
+		return nil, errors.New("deleted file has unexpected content")
+	}
+	return []byte(strings.Join(out, "")), nil
+}
+
+// findLines returns the index nearest to want, and not before min,
+// at which lines contains the sequence seq, or -1.
+func findLines(lines, seq []string, want, min int) int {
+	match := func(at int) bool {
+		if at < min || at+len(seq) > len(lines) {
+			return false
+		}
+		for i, l := range seq {
+			if lines[at+i] != l {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; d <= len(lines); d++ {
+		if match(want + d) {
+			return want + d
+		}
+		if d > 0 && match(want-d) {
+			return want - d
+		}
+	}
+	return -1
+}
+
+// applyPatch applies the patch file to the tree rooted at dir. Changes
+// to a file are only written once every file in the patch has been
+// patched successfully. Changes that are already present are skipped,
+// as are files not selected by keep, if it is non-nil.
+func applyPatch(dir, file string, keep func(name string) bool) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	fps, err := parsePatch(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	type result struct {
+		path string
+		data []byte
+		rm   bool
+	}
+	var results []result
+	for _, fp := range fps {
+		name := fp.newName
+		if name == "" {
+			name = fp.oldName
+		}
+		if keep != nil && !keep(name) {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		cur, err := ioutil.ReadFile(path)
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		b, err := fp.apply(cur, exists)
+		if err != nil {
+			if _, rerr := fp.reverse().apply(cur, exists); rerr == nil {
+				debugln("patch already applied to", path)
+				continue
+			}
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		results = append(results, result{path, b, fp.newName == ""})
+	}
+	for _, r := range results {
+		if r.rm {
+			err = os.Remove(r.path)
+		} else {
+			err = writePatchedFile(r.path, r.data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePatchedFile replaces the contents of path, keeping its mode.
+// A hard link at path is replaced, not written through.
+func writePatchedFile(path string, data []byte) error {
+	mode := os.FileMode(0666)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return replaceFile(path, mode, data)
+}
+
+// splitLines splits data into lines, keeping line terminators.
+// The last line has no terminator if data does not end in one.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffTrees writes a unified diff, with paths relative to the roots,
+// that turns the regular files under a into those under b.
+func diffTrees(w io.Writer, a, b string) error {
+	af, err := treeFiles(a)
+	if err != nil {
+		return err
+	}
+	bf, err := treeFiles(b)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for n := range af {
+		names = append(names, n)
+	}
+	for n := range bf {
+		if !af[n] {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		var ad, bd []byte
+		if af[n] {
+			if ad, err = ioutil.ReadFile(filepath.Join(a, filepath.FromSlash(n))); err != nil {
+				return err
+			}
+		}
+		if bf[n] {
+			if bd, err = ioutil.ReadFile(filepath.Join(b, filepath.FromSlash(n))); err != nil {
+				return err
+			}
+		}
+		if af[n] == bf[n] && bytes.Equal(ad, bd) {
+			continue
+		}
+		if err := writeFileDiff(w, n, ad, bd, af[n], bf[n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// treeFiles returns the slash-separated paths of the regular files under root.
+func treeFiles(root string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	return files, err
+}
+
+// writeFileDiff writes a unified diff, with three lines of context,
+// between the contents a and b of the file name. aok and bok report
+// whether the file exists on each side.
+func writeFileDiff(w io.Writer, name string, a, b []byte, aok, bok bool) error {
+	from, to := "a/"+name, "b/"+name
+	if !aok {
+		from = "/dev/null"
+	}
+	if !bok {
+		to = "/dev/null"
+	}
+	return writeDiff(w, from, to, a, b)
+}
+
+// writeDiff writes a unified diff, with three lines of context, between
+// the contents a and b of the files labeled from and to.
+func writeDiff(w io.Writer, from, to string, a, b []byte) error {
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", from, to); err != nil {
+		return err
+	}
+	al, bl := splitLines(a), splitLines(b)
+	m := difflib.NewMatcherWithJunk(al, bl, false, nil)
+	for _, g := range m.GetGroupedOpCodes(3) {
+		first, last := g[0], g[len(g)-1]
+		_, err := fmt.Fprintf(w, "@@ -%s +%s @@\n", unifiedRange(first.I1, last.I2), unifiedRange(first.J1, last.J2))
+		if err != nil {
+			return err
+		}
+		for _, c := range g {
+			if c.Tag == 'e' {
+				writeDiffLines(w, ' ', al[c.I1:c.I2])
+				continue
+			}
+			if c.Tag == 'r' || c.Tag == 'd' {
+				writeDiffLines(w, '-', al[c.I1:c.I2])
+			}
+			if c.Tag == 'r' || c.Tag == 'i' {
+				writeDiffLines(w, '+', bl[c.J1:c.J2])
+			}
+		}
+	}
+	return nil
+}
+
+func writeDiffLines(w io.Writer, op byte, lines []string) {
+	for _, l := range lines {
+		fmt.Fprintf(w, "%c%s", op, l)
+		if !strings.HasSuffix(l, "\n") {
+			fmt.Fprint(w, "\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// unifiedRange formats a hunk range, see difflib's formatRangeUnified.
+func unifiedRange(start, stop int) string {
+	n := stop - start
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return strconv.Itoa(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
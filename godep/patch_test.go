@@ -0,0 +1,128 @@
+package godep
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// patchAddDecl returns a patch adding decl(add) after decl(after)
+// in the main.go written by pkg(name).
+func patchAddDecl(after, add string) string {
+	return `--- a/main.go
++++ b/main.go
+@@ -3,3 +3,4 @@
+ import (
+ )
+ var ` + after + ` int
++var ` + add + ` int
+`
+}
+
+func TestPatchRoundTrip(t *testing.T) {
+	var cases = []struct {
+		a, b string
+		aok  bool
+		bok  bool
+	}{
+		{"a\nb\nc\n", "a\nB\nc\n", true, true},
+		{"a\nb\nc\n", "a\nb\nc\nd", true, true},
+		{"a\nb\nc", "a\nb\nc\n", true, true},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n", true, true},
+		{"", "new\nfile\n", false, true},
+		{"old\nfile\n", "", true, false},
+	}
+	for i, test := range cases {
+		var buf bytes.Buffer
+		err := writeFileDiff(&buf, "x.go", []byte(test.a), []byte(test.b), test.aok, test.bok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fps, err := parsePatch(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%d parsePatch: %v\n%s", i, err, buf.String())
+		}
+		if len(fps) != 1 {
+			t.Fatalf("%d parsePatch returned %d files want 1", i, len(fps))
+		}
+		got, err := fps[0].apply([]byte(test.a), test.aok)
+		if err != nil {
+			t.Errorf("%d apply: %v\n%s", i, err, buf.String())
+		}
+		if string(got) != test.b {
+			t.Errorf("%d apply = %q want %q", i, got, test.b)
+		}
+		back, err := fps[0].reverse().apply([]byte(test.b), test.bok)
+		if err != nil {
+			t.Errorf("%d reverse apply: %v\n%s", i, err, buf.String())
+		}
+		if string(back) != test.a {
+			t.Errorf("%d reverse apply = %q want %q", i, back, test.a)
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	err := os.RemoveAll(scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(scratch, "D")
+	makeTree(t, &node{scratch, "", []*node{
+		{"D/main.go", pkg("D") + decl("D1"), nil},
+		{"D/P/main.go", pkg("P") + decl("D1"), nil},
+		{"ok.patch", patchRenameDecl("D1", "D3") + patchRenameDecl("D1", "D4", "P"), nil},
+		{"bad.patch", patchRenameDecl("D2", "D3"), nil},
+	}}, "")
+
+	if err := applyPatch(dir, filepath.Join(scratch, "bad.patch"), nil); err == nil {
+		t.Error("bad.patch applied, want error")
+	}
+	// Patches may not create files outside the dependency.
+	abs, err := filepath.Abs(filepath.Join(scratch, "abs.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"../escape.go", filepath.ToSlash(abs)} {
+		patch := "--- /dev/null\n+++ b/" + name + "\n@@ -0,0 +1 @@\n+package x\n"
+		if err := ioutil.WriteFile(filepath.Join(scratch, "new.patch"), []byte(patch), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyPatch(dir, filepath.Join(scratch, "new.patch"), nil); err == nil {
+			t.Errorf("patch creating %s applied, want error", name)
+		}
+	}
+	checkTree(t, 0, &node{scratch, "", []*node{
+		{"escape.go", "(absent)", nil},
+		{"abs.go", "(absent)", nil},
+	}})
+	// Only the root package is fresh, P was patched earlier.
+	keep := freshFiles("D", []Dependency{{ImportPath: "D"}})
+	for i := 0; i < 2; i++ { // the second application is a no-op
+		if err := applyPatch(dir, filepath.Join(scratch, "ok.patch"), keep); err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, i, &node{dir, "", []*node{
+			{"main.go", pkg("D") + decl("D3"), nil},
+			{"P/main.go", pkg("P") + decl("D1"), nil},
+		}})
+	}
+}
+
+// patchRenameDecl returns a patch replacing decl(from) with decl(to) in
+// the main.go written by pkg, in directory dir if given.
+func patchRenameDecl(from, to string, dir ...string) string {
+	name := filepath.ToSlash(filepath.Join(append(dir, "main.go")...))
+	return `--- a/` + name + `
++++ b/` + name + `
+@@ -3,3 +3,3 @@
+ import (
+ )
+-var ` + from + ` int
++var ` + to + ` int
+`
+}
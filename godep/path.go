@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"fmt"
@@ -27,10 +27,10 @@ func runPath(cmd *Command, args []string) {
 	if len(args) != 0 {
 		cmd.UsageExit()
 	}
-	if VendorExperiment {
+	if vendorExperiment {
 		fmt.Fprintln(os.Stderr, "Error: GO15VENDOREXPERIMENT is enabled and the vendor/ directory is not a valid Go workspace.")
-		os.Exit(1)
+		exit(1)
 	}
 	gopath := prepareGopath()
-	fmt.Println(gopath)
+	fmt.Fprintln(stdout, gopath)
 }
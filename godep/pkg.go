@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"go/build"
@@ -31,14 +31,16 @@ type Package struct {
 	// --- New stuff for now
 	Imports      []string
 	Dependencies []build.Package
+	Ignored      []string            // imports skipped because of the Ignore list
+	Targets      map[string][]string // dependency => targets needing it, if targets are set
 }
 
-// LoadPackages loads the named packages
+// loadPackages loads the named packages
 // Unlike the go tool, an empty argument list is treated as an empty list; "."
 // must be given explicitly if desired.
 // IgnoredGoFiles will be processed and their dependencies resolved recursively
-func LoadPackages(names ...string) (a []*Package, err error) {
-	debugln("LoadPackages", names)
+func loadPackages(names ...string) (a []*Package, err error) {
+	debugln("loadPackages", names)
 	if len(names) == 0 {
 		return nil, nil
 	}
@@ -0,0 +1,391 @@
+package godep
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var cmdApply = &Command{
+	Name:  "apply",
+	Args:  "file.json",
+	Short: "carry out a plan written by -plan-out",
+	Long: `
+Apply carries out a plan written by 'godep save -plan-out file.json',
+or the same flag of update, restore or unrewrite.
+
+Apply first plans the command again. If the manifest, the local patches
+or the copied source have changed since the plan was made, or the new
+plan differs from the reviewed one in any other way, apply refuses to
+do anything.
+`,
+	Run:          runApply,
+	OnlyInGOPATH: true,
+}
+
+var (
+	planOnly bool   // -n
+	planOut  string // -plan-out
+
+	// planning is the plan being made, if any. Mutating commands check
+	// it and record what they would do instead of doing it.
+	planning *Plan
+)
+
+// planner returns the command that can be planned with the given name,
+// and the function that carries it out.
+func planner(name string) (*Command, func([]string) error) {
+	switch name {
+	case "save":
+		return cmdSave, save
+	case "update":
+		return cmdUpdate, updateAll
+	case "restore":
+		return cmdRestore, restoreAll
+	case "unrewrite":
+		return cmdUnrewrite, unrewrite
+	}
+	return nil, nil
+}
+
+// Plan is what a mutating command would do, as printed by -n and
+// written by -plan-out.
+type Plan struct {
+	Command   string
+	Flags     map[string]string `json:",omitempty"` // command flags that were set
+	Args      []string          `json:",omitempty"`
+	GoVersion string            `json:",omitempty"` // go version to record
+	Added     []PlanDep         `json:",omitempty"`
+	Removed   []PlanDep         `json:",omitempty"`
+	Revised   []PlanRev         `json:",omitempty"`
+	Copied    []string          `json:",omitempty"` // files written, relative to the project
+	Deleted   []string          `json:",omitempty"` // files removed, relative to the project
+	Rewritten []string          `json:",omitempty"` // files whose imports are rewritten
+	Checkouts []PlanCheckout    `json:",omitempty"`
+	State     string            // digest of the manifest, patches and copied source
+
+	live, stage string // the source tree and its staging copy, if staged
+}
+
+// PlanDep is a dependency added or removed by a plan.
+type PlanDep struct {
+	ImportPath string
+	Rev        string
+	Comment    string `json:",omitempty"`
+}
+
+// PlanRev is a dependency moved to another revision by a plan.
+type PlanRev struct {
+	ImportPath string
+	From, To   string
+}
+
+// PlanCheckout is a VCS operation in GOPATH made by a plan.
+type PlanCheckout struct {
+	Action     string // clone, fetch or checkout
+	ImportPath string
+	Dir        string
+	Rev        string
+}
+
+func addPlanFlags(f *flag.FlagSet) {
+	f.BoolVar(&planOnly, "n", false, "print what would be done, without doing it")
+	f.StringVar(&planOut, "plan-out", "", "write what would be done to this file, for 'godep apply'")
+}
+
+// runPlanned runs fn, the body of a mutating command, or only plans
+// it if -n or -plan-out was given.
+func runPlanned(cmd *Command, args []string, fn func([]string) error) {
+	if !planOnly && planOut == "" {
+		if err := fn(args); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	p, err := makePlan(cmd, args, fn)
+	if err != nil {
+		fatal(err)
+	}
+	if planOnly {
+		p.writeText(stdout)
+	}
+	if planOut != "" {
+		b, err := json.MarshalIndent(p, "", "\t")
+		if err != nil {
+			fatal(err)
+		}
+		if err := ioutil.WriteFile(planOut, append(b, '\n'), 0666); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// makePlan runs fn in planning mode and returns the plan it made.
+func makePlan(cmd *Command, args []string, fn func([]string) error) (*Plan, error) {
+	state, err := workspaceState()
+	if err != nil {
+		return nil, err
+	}
+	p := &Plan{Command: cmd.Name, Args: args, State: state}
+	cmd.Flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "n", "plan-out", "v", "d", "cpuprofile", "gitlib", "json":
+			return
+		}
+		if p.Flags == nil {
+			p.Flags = make(map[string]string)
+		}
+		p.Flags[f.Name] = f.Value.String()
+	})
+	planning = p
+	defer func() { planning = nil }()
+	if err := fn(args); err != nil && err != errorPatchConflicts {
+		return nil, err
+	}
+	sort.Strings(p.Rewritten)
+	p.Rewritten = uniq(p.Rewritten)
+	return p, nil
+}
+
+func runApply(cmd *Command, args []string) {
+	if len(args) != 1 {
+		cmd.UsageExit()
+	}
+	b, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fatal(err)
+	}
+	var p Plan
+	if err := json.Unmarshal(b, &p); err != nil {
+		fatalf("Unable to parse %s: %v\n", args[0], err)
+	}
+	if err := apply(&p); err != nil {
+		fatal(err)
+	}
+}
+
+// apply carries out p, provided planning it again gives the same plan.
+func apply(p *Plan) error {
+	c, fn := planner(p.Command)
+	if c == nil {
+		return fmt.Errorf("cannot apply a plan for %q", p.Command)
+	}
+	for name, value := range p.Flags {
+		if err := c.Flag.Set(name, value); err != nil {
+			return err
+		}
+	}
+	now, err := makePlan(c, p.Args, fn)
+	if err != nil {
+		return err
+	}
+	if now.State != p.State {
+		return errorPlanStale
+	}
+	want, _ := json.Marshal(p)
+	got, _ := json.Marshal(now)
+	if !bytes.Equal(want, got) {
+		if verbose {
+			now.writeText(os.Stderr)
+		}
+		return errorPlanStale
+	}
+	verboseln("Applying plan for", p.Command)
+	return fn(p.Args)
+}
+
+// deps records the difference between the dependency lists old and new.
+func (p *Plan) deps(old, new []Dependency) {
+	if p == nil {
+		return
+	}
+	for _, d := range new {
+		var found bool
+		for _, o := range old {
+			if o.ImportPath == d.ImportPath {
+				found = true
+				if o.Rev != d.Rev {
+					p.Revised = append(p.Revised, PlanRev{ImportPath: d.ImportPath, From: o.Rev, To: d.Rev})
+				}
+			}
+		}
+		if !found {
+			p.Added = append(p.Added, PlanDep{ImportPath: d.ImportPath, Rev: d.Rev, Comment: d.Comment})
+		}
+	}
+	for _, d := range subDeps(old, new) {
+		p.Removed = append(p.Removed, PlanDep{ImportPath: d.ImportPath, Rev: d.Rev, Comment: d.Comment})
+	}
+}
+
+// staged records the files that differ between the source tree live
+// and its staging copy stage.
+func (p *Plan) staged(live, stage string) error {
+	if p == nil {
+		return nil
+	}
+	p.live, p.stage = filepath.Clean(live), filepath.Clean(stage)
+	lf, err := treeFiles(live)
+	if err != nil {
+		return err
+	}
+	sf, err := treeFiles(stage)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for n := range sf {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if lf[n] {
+			a, err := ioutil.ReadFile(filepath.Join(live, filepath.FromSlash(n)))
+			if err != nil {
+				return err
+			}
+			b, err := ioutil.ReadFile(filepath.Join(stage, filepath.FromSlash(n)))
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(a, b) {
+				continue
+			}
+		}
+		p.Copied = append(p.Copied, filepath.ToSlash(filepath.Join(live, n)))
+	}
+	names = names[:0]
+	for n := range lf {
+		if !sf[n] {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		p.Deleted = append(p.Deleted, filepath.ToSlash(filepath.Join(live, n)))
+	}
+	return nil
+}
+
+// rewrote records that the imports of file name would be rewritten.
+// Files in the staging copy are recorded under their live names, and
+// the live files they replace are left out.
+func (p *Plan) rewrote(name string) {
+	name = filepath.Clean(name)
+	if p.stage != "" {
+		if hasFilePathPrefix(name, p.live) {
+			return
+		}
+		if hasFilePathPrefix(name, p.stage) {
+			name = filepath.Join(p.live, name[len(p.stage):])
+		}
+	}
+	p.Rewritten = append(p.Rewritten, filepath.ToSlash(name))
+}
+
+func (p *Plan) checkout(action string, dep *Dependency) {
+	p.Checkouts = append(p.Checkouts, PlanCheckout{
+		Action:     action,
+		ImportPath: dep.ImportPath,
+		Dir:        dep.root,
+		Rev:        dep.Rev,
+	})
+}
+
+func (p *Plan) writeText(w io.Writer) {
+	fmt.Fprintf(w, "godep %s", p.Command)
+	var flags []string
+	for name, value := range p.Flags {
+		flags = append(flags, "-"+name+"="+value)
+	}
+	sort.Strings(flags)
+	for _, a := range append(flags, p.Args...) {
+		fmt.Fprintf(w, " %s", a)
+	}
+	fmt.Fprintln(w)
+	if p.GoVersion != "" {
+		fmt.Fprintf(w, "record go version %s\n", p.GoVersion)
+	}
+	for _, d := range p.Added {
+		fmt.Fprintf(w, "add %s %s\n", d.ImportPath, revDesc(d.Rev, d.Comment))
+	}
+	for _, d := range p.Removed {
+		fmt.Fprintf(w, "remove %s %s\n", d.ImportPath, revDesc(d.Rev, d.Comment))
+	}
+	for _, r := range p.Revised {
+		fmt.Fprintf(w, "revise %s %s -> %s\n", r.ImportPath, shortRev(r.From), shortRev(r.To))
+	}
+	for _, c := range p.Checkouts {
+		fmt.Fprintf(w, "%s %s in %s at %s\n", c.Action, c.ImportPath, c.Dir, shortRev(c.Rev))
+	}
+	for _, f := range p.Copied {
+		fmt.Fprintln(w, "copy", f)
+	}
+	for _, f := range p.Deleted {
+		fmt.Fprintln(w, "delete", f)
+	}
+	for _, f := range p.Rewritten {
+		fmt.Fprintln(w, "rewrite", f)
+	}
+	if len(p.Added)+len(p.Removed)+len(p.Revised)+len(p.Checkouts)+len(p.Copied)+len(p.Deleted)+len(p.Rewritten) == 0 && p.GoVersion == "" {
+		fmt.Fprintln(w, "nothing to do")
+	}
+}
+
+func revDesc(rev, comment string) string {
+	if comment != "" {
+		return shortRev(rev) + " (" + comment + ")"
+	}
+	return shortRev(rev)
+}
+
+func shortRev(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
+
+// workspaceState returns a digest of the manifest, the local patches
+// and the copied source, by which apply notices they have changed.
+func workspaceState() (string, error) {
+	h := sha256.New()
+	for _, root := range []string{godepsFile, patchDir, relativeVendorTarget(vendorExperiment)} {
+		root = filepath.Clean(root)
+		err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return nil
+				}
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(path), len(b))
+			h.Write(b)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// hasFilePathPrefix reports whether path is dir or inside it.
+func hasFilePathPrefix(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,124 @@
+package godep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanDeps(t *testing.T) {
+	old := []Dependency{
+		{ImportPath: "A", Rev: "a1"},
+		{ImportPath: "B", Rev: "b1"},
+		{ImportPath: "C", Rev: "c1", Comment: "v1"},
+	}
+	new := []Dependency{
+		{ImportPath: "A", Rev: "a1"},
+		{ImportPath: "B", Rev: "b2"},
+		{ImportPath: "D", Rev: "d1"},
+	}
+	var p Plan
+	p.deps(old, new)
+	if want := []PlanDep{{ImportPath: "D", Rev: "d1"}}; !reflect.DeepEqual(p.Added, want) {
+		t.Errorf("Added = %v want %v", p.Added, want)
+	}
+	if want := []PlanDep{{ImportPath: "C", Rev: "c1", Comment: "v1"}}; !reflect.DeepEqual(p.Removed, want) {
+		t.Errorf("Removed = %v want %v", p.Removed, want)
+	}
+	if want := []PlanRev{{ImportPath: "B", From: "b1", To: "b2"}}; !reflect.DeepEqual(p.Revised, want) {
+		t.Errorf("Revised = %v want %v", p.Revised, want)
+	}
+
+	var np *Plan
+	np.deps(old, new) // must not panic when not planning
+}
+
+func TestPlanStaged(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "godep-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	writeFile(filepath.Join("vendor", "A", "a.go"), "package A\n")
+	writeFile(filepath.Join("vendor", "B", "b.go"), "package B\n")
+	writeFile(filepath.Join("vendor", "C", "c.go"), "package C\n")
+	writeFile(filepath.Join(".godep-stage", "A", "a.go"), "package A\n")
+	writeFile(filepath.Join(".godep-stage", "B", "b.go"), "package B // changed\n")
+	writeFile(filepath.Join(".godep-stage", "D", "d.go"), "package D\n")
+
+	var p Plan
+	if err := p.staged("vendor/", ".godep-stage"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"vendor/B/b.go", "vendor/D/d.go"}; !reflect.DeepEqual(p.Copied, want) {
+		t.Errorf("Copied = %v want %v", p.Copied, want)
+	}
+	if want := []string{"vendor/C/c.go"}; !reflect.DeepEqual(p.Deleted, want) {
+		t.Errorf("Deleted = %v want %v", p.Deleted, want)
+	}
+
+	p.rewrote(filepath.Join(".godep-stage", "D", "d.go"))
+	p.rewrote(filepath.Join("vendor", "A", "a.go"))
+	p.rewrote("main.go")
+	if want := []string{"vendor/D/d.go", "main.go"}; !reflect.DeepEqual(p.Rewritten, want) {
+		t.Errorf("Rewritten = %v want %v", p.Rewritten, want)
+	}
+}
+
+func TestPlanSaveWritesNothing(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	if err := os.RemoveAll(scratch); err != nil {
+		t.Fatal(err)
+	}
+	setGlobals(true)
+	src := filepath.Join(scratch, "r1", "src")
+	makeTree(t, &node{src, "", []*node{
+		{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+		{"C", "", []*node{{"main.go", pkg("main", "D"), nil}, {"+git", "", nil}}},
+	}}, "")
+	if err := os.Chdir(filepath.Join(src, "C")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	setGOPATH(filepath.Join(wd, scratch, "r1"))
+
+	p, err := makePlan(cmdSave, nil, save)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"vendor/D/main.go"}; !reflect.DeepEqual(p.Copied, want) {
+		t.Errorf("Copied = %v want %v", p.Copied, want)
+	}
+	for _, name := range []string{"vendor", ".godep-stage", "Godeps"} {
+		if _, err := os.Lstat(name); !os.IsNotExist(err) {
+			t.Errorf("dry run wrote %s", name)
+		}
+	}
+
+	// An interrupted run is left for a real one to roll back.
+	if err := writeFile(journalFile, `{"Op": "save", "Phase": "staging"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := makePlan(cmdSave, nil, save); err != errorTxnPending {
+		t.Errorf("dry run with a journal: err = %v want %v", err, errorTxnPending)
+	}
+	if _, err := os.Stat(journalFile); err != nil {
+		t.Errorf("dry run removed the journal: %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package godep
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// A Plugin is an executable named godep-name on PATH, run for the
+// command godep name when godep has no command of that name, the way
+// git runs git-name.
+//
+// The plugin is run in the current directory with the arguments after
+// the command name, and with these set in its environment:
+//
+//	GODEP                    the path of the godep executable
+//	GODEP_ROOT               the project root: the nearest directory
+//	                         holding Godeps, or else the current one
+//	GODEP_MANIFEST           the path of Godeps/Godeps.json in it
+//	GODEP_VENDOR             the directory dependencies are copied to:
+//	                         vendor or Godeps/_workspace/src in it
+//	GODEP_VENDOR_EXPERIMENT  true if dependencies go in vendor, else false
+//	GODEP_GO_VERSION         the major Go version godep acts for, as go1.7
+//
+// Its short description, listed by godep help, is the rest of the
+// first line of its file holding "godep-short:", which may be a
+// comment in a script or a string in a compiled program.
+type Plugin struct {
+	Name  string // as a command
+	Path  string
+	Short string
+}
+
+const pluginPrefix = "godep-"
+
+// LookPlugin returns the plugin for the command name, or nil if there
+// is none on PATH.
+func LookPlugin(name string) *Plugin {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return nil
+	}
+	return &Plugin{Name: name, Path: path, Short: pluginShort(path)}
+}
+
+// FindPlugins returns the plugins on PATH, sorted by name. Of plugins
+// with the same name, only the first on PATH is run, and returned.
+func FindPlugins() []*Plugin {
+	seen := make(map[string]bool)
+	var a []*Plugin
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range files {
+			name := pluginFileName(fi.Name())
+			if !strings.HasPrefix(name, pluginPrefix) || len(name) == len(pluginPrefix) {
+				continue
+			}
+			name = name[len(pluginPrefix):]
+			if seen[name] {
+				continue
+			}
+			if p := LookPlugin(name); p != nil {
+				seen[name] = true
+				a = append(a, p)
+			}
+		}
+	}
+	sort.Sort(byPluginName(a))
+	return a
+}
+
+// pluginFileName returns the command file name without the extension
+// exec.LookPath adds to it: one of PATHEXT on Windows, none elsewhere.
+func pluginFileName(name string) string {
+	if runtime.GOOS != "windows" {
+		return name
+	}
+	exts := os.Getenv("PATHEXT")
+	if exts == "" {
+		exts = ".com;.exe;.bat;.cmd"
+	}
+	ext := filepath.Ext(name)
+	for _, e := range strings.Split(exts, ";") {
+		if e != "" && strings.EqualFold(e, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// byPluginName sorts plugins by name.
+type byPluginName []*Plugin
+
+func (a byPluginName) Len() int           { return len(a) }
+func (a byPluginName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byPluginName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+// pluginShort returns the short description of the plugin in the file
+// path, or "" if it has none.
+func pluginShort(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	marker := []byte("godep-short:")
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadSlice('\n')
+		if i := bytes.Index(line, marker); i >= 0 {
+			s := line[i+len(marker):]
+			if j := bytes.IndexByte(s, 0); j >= 0 {
+				s = s[:j]
+			}
+			return strings.TrimSpace(string(s))
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return ""
+		}
+	}
+}
+
+// Exec runs p with args and the settings in o, as described for
+// Plugin but in o.Dir, and exits with its status.
+func (p *Plugin) Exec(o *Options, args []string) {
+	env, err := PluginEnv(o)
+	if err != nil {
+		fatal(err)
+	}
+	cmd := exec.Command(p.Path, args...)
+	cmd.Dir = o.Dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if e, ok := err.(*exec.ExitError); ok {
+			if ws, ok := e.Sys().(syscall.WaitStatus); ok && ws.ExitStatus() > 0 {
+				os.Exit(ws.ExitStatus())
+			}
+			os.Exit(1)
+		}
+		fatal(err)
+	}
+	os.Exit(0)
+}
+
+// PluginEnv returns the environment variables godep sets for plugins,
+// as described for Plugin, for the project in o.Dir, as name=value.
+func PluginEnv(o *Options) ([]string, error) {
+	self, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(o.Dir)
+	if err != nil {
+		return nil, err
+	}
+	root, _ := findInParents(dir, "Godeps")
+	if root == "" {
+		root = dir
+	}
+	// Settings such as Godeps/config.json are those of the root.
+	ro := *o
+	ro.Dir = root
+	end, err := ro.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	vendor := filepath.Join(root, "vendor")
+	if !vendorExperiment {
+		vendor = filepath.Join(root, "Godeps", "_workspace", "src")
+	}
+	return []string{
+		"GODEP=" + self,
+		"GODEP_ROOT=" + root,
+		"GODEP_MANIFEST=" + filepath.Join(root, godepsFile),
+		"GODEP_VENDOR=" + vendor,
+		"GODEP_VENDOR_EXPERIMENT=" + strconv.FormatBool(vendorExperiment),
+		"GODEP_GO_VERSION=" + majorGoVersion,
+	}, nil
+}
+
+// executable returns the absolute path of the running godep, as found
+// from os.Args[0].
+func executable() (string, error) {
+	name := os.Args[0]
+	if filepath.Base(name) == name {
+		p, err := exec.LookPath(name)
+		if err != nil {
+			return "", err
+		}
+		name = p
+	}
+	return filepath.Abs(name)
+}
@@ -0,0 +1,88 @@
+package godep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins here are shell scripts")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	os.RemoveAll(scratch)
+	bin1 := filepath.Join(wd, scratch, "bin1")
+	bin2 := filepath.Join(wd, scratch, "bin2")
+	files := []struct {
+		path, body string
+		mode       os.FileMode
+	}{
+		{filepath.Join(bin1, "godep-foo"), "#!/bin/sh\n# godep-short: frobnicate the deps\n", 0755},
+		{filepath.Join(bin1, "godep-bar"), "#!/bin/sh\n", 0755},
+		{filepath.Join(bin1, "godep-baz.sh"), "#!/bin/sh\n", 0755},
+		{filepath.Join(bin1, "godep-data"), "not a plugin\n", 0644},
+		{filepath.Join(bin2, "godep-foo"), "#!/bin/sh\n# godep-short: shadowed\n", 0755},
+		{filepath.Join(bin2, "other"), "#!/bin/sh\n", 0755},
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f.path, []byte(f.body), f.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin1+string(filepath.ListSeparator)+bin2)
+
+	want := []*Plugin{
+		{Name: "bar", Path: filepath.Join(bin1, "godep-bar")},
+		{Name: "baz.sh", Path: filepath.Join(bin1, "godep-baz.sh")},
+		{Name: "foo", Path: filepath.Join(bin1, "godep-foo"), Short: "frobnicate the deps"},
+	}
+	if got := FindPlugins(); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindPlugins = %+v want %+v", got, want)
+	}
+	for _, name := range []string{"data", "other", "baz", "", "../bin2/godep-foo"} {
+		if p := LookPlugin(name); p != nil {
+			t.Errorf("LookPlugin(%q) = %+v want nil", name, p)
+		}
+	}
+
+	root := filepath.Join(wd, scratch, "C")
+	if err := os.MkdirAll(filepath.Join(root, "Godeps"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The root's config applies in its subdirectories.
+	if err := ioutil.WriteFile(filepath.Join(root, configFile), []byte(`{"Vendor": "workspace"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := PluginEnv(&Options{Dir: filepath.Join(root, "sub"), GoVersion: "go1.6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, _ := filepath.Abs(os.Args[0])
+	wenv := []string{
+		"GODEP=" + self,
+		"GODEP_ROOT=" + root,
+		"GODEP_MANIFEST=" + filepath.Join(root, "Godeps", "Godeps.json"),
+		"GODEP_VENDOR=" + filepath.Join(root, "Godeps", "_workspace", "src"),
+		"GODEP_VENDOR_EXPERIMENT=false",
+		"GODEP_GO_VERSION=go1.6",
+	}
+	if !reflect.DeepEqual(env, wenv) {
+		t.Errorf("PluginEnv = %q want %q", env, wenv)
+	}
+}
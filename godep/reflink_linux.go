@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package godep
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl from linux/fs.h.
+const ficlone = 0x40049409
+
+// reflink makes dst a copy-on-write clone of src, on filesystems that
+// support it, such as btrfs and xfs.
+func reflink(dst, src string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	fi, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, w.Fd(), ficlone, r.Fd())
+	err = w.Close()
+	if errno != 0 {
+		err = errno
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package godep
+
+// reflink is only implemented on linux.
+func reflink(dst, src string) error {
+	return errReflinkUnsupported
+}
@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"errors"
@@ -12,10 +12,15 @@ import (
 
 var cmdRestore = &Command{
 	Name:  "restore",
+	Args:  "[-n] [-plan-out file]",
 	Short: "check out listed dependency versions in GOPATH",
 	Long: `
 Restore checks out the Godeps-specified version of each package in GOPATH.
 
+If -n is given, restore prints the repositories it would clone, fetch
+and check out, without touching them. If -plan-out is given, the same
+plan is written to the named file as JSON, for 'godep apply'.
+
 NOTE: restore leaves git repositories in a detached state. go1.6+ no longer
 checks out the master branch when doing a "go get", see:
 https://github.com/golang/go/commit/42206598671a44111c8f726ad33dc7b265bdf669.
@@ -25,38 +30,50 @@ https://github.com/golang/go/commit/42206598671a44111c8f726ad33dc7b265bdf669.
 	OnlyInGOPATH: true,
 }
 
+func init() {
+	addPlanFlags(&cmdRestore.Flag)
+}
+
+func runRestore(cmd *Command, args []string) {
+	runPlanned(cmd, args, restoreAll)
+}
+
 // Three phases:
 // 1. Download all deps
 // 2. Restore all deps (checkout the recorded rev)
 // 3. Attempt to load all deps as a simple consistency check
-func runRestore(cmd *Command, args []string) {
+func restoreAll(args []string) error {
 	if len(build.Default.GOPATH) == 0 {
-		log.Println("Error restore requires GOPATH but it is empty.")
-		os.Exit(1)
+		return errors.New("Error restore requires GOPATH but it is empty.")
 	}
+	downloaded = make(map[string]bool)
+	restored = make(map[string]string)
 
 	var hadError bool
-	checkErr := func(s string) {
+	checkErr := func(s string) error {
 		if hadError {
-			log.Println(s)
-			os.Exit(1)
+			return errors.New(s)
 		}
+		return nil
 	}
 
 	g, err := loadDefaultGodepsFile()
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	for i, dep := range g.Deps {
 		verboseln("Downloading dependency (if needed):", dep.ImportPath)
 		err := download(&dep)
 		if err != nil {
 			log.Printf("error downloading dep (%s): %s\n", dep.ImportPath, err)
+			depResult("download", dep, err)
 			hadError = true
 		}
 		g.Deps[i] = dep
 	}
-	checkErr("Error downloading some deps. Aborting restore and check.")
+	if err := checkErr("Error downloading some deps. Aborting restore and check."); err != nil {
+		return err
+	}
 	for _, dep := range g.Deps {
 		verboseln("Restoring dependency (if needed):", dep.ImportPath)
 		err := restore(dep)
@@ -64,21 +81,30 @@ func runRestore(cmd *Command, args []string) {
 			log.Printf("error restoring dep (%s): %s\n", dep.ImportPath, err)
 			hadError = true
 		}
+		if planning == nil {
+			depResult("restore", dep, err)
+		}
+	}
+	if err := checkErr("Error restoring some deps. Aborting check."); err != nil {
+		return err
+	}
+	if planning != nil {
+		return nil
 	}
-	checkErr("Error restoring some deps. Aborting check.")
 	for _, dep := range g.Deps {
 		verboseln("Checking dependency:", dep.ImportPath)
-		_, err := LoadPackages(dep.ImportPath)
+		_, err := loadPackages(dep.ImportPath)
 		if err != nil {
 			log.Printf("Dep (%s) restored, but was unable to load it with error:\n\t%s\n", dep.ImportPath, err)
 			if me, ok := err.(errorMissingDep); ok {
 				log.Println("\tThis may be because the dependencies were saved with an older version of godep (< v33).")
 				log.Printf("\tTry `go get %s`. Then `godep save` to update deps.\n", me.i)
 			}
+			depResult("check", dep, err)
 			hadError = true
 		}
 	}
-	checkErr("Error checking some deps.")
+	return checkErr("Error checking some deps.")
 }
 
 var downloaded = make(map[string]bool)
@@ -122,6 +148,11 @@ func download(dep *Dependency) error {
 
 	fi, err := os.Stat(dep.root)
 	if err != nil {
+		if os.IsNotExist(err) && planning != nil {
+			planning.checkout("clone", dep)
+			downloaded[rr.Repo] = true
+			return nil
+		}
 		if os.IsNotExist(err) {
 			if err := os.MkdirAll(filepath.Dir(dep.root), os.ModePerm); err != nil {
 				debugln("Error creating base dir of", dep.root)
@@ -144,6 +175,11 @@ func download(dep *Dependency) error {
 		return errors.New("repo root src dir exists, but isn't a directory for " + dep.ImportPath + " at " + dep.root)
 	}
 
+	if !dep.vcs.exists(dep.root, dep.Rev) && planning != nil {
+		planning.checkout("fetch", dep)
+		downloaded[rr.Repo] = true
+		return nil
+	}
 	if !dep.vcs.exists(dep.root, dep.Rev) {
 		debugln("Updating existing", dep.root)
 		if dep.vcs == vcsGit {
@@ -186,6 +222,13 @@ func restore(dep Dependency) error {
 		return nil
 	}
 
+	if planning != nil {
+		if id, err := dep.vcs.identify(dep.root); err != nil || id != dep.Rev {
+			planning.checkout("checkout", &dep)
+		}
+		restored[dep.root] = dep.Rev
+		return nil
+	}
 	debugln("Restoring:", dep.ImportPath, dep.Rev)
 	err := dep.vcs.RevSync(dep.root, dep.Rev)
 	if err == nil {
@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"bytes"
@@ -27,7 +27,7 @@ func rewrite(pkgs []*Package, qual string, paths []string) error {
 			return err
 		}
 	}
-	return rewriteTree("Godeps", qual, paths)
+	return rewriteTree(inProject("Godeps"), qual, paths)
 }
 
 // pkgFiles returns the full filesystem path to all go files in pkgs.
@@ -70,6 +70,15 @@ func rewriteTree(path, qual string, paths []string) error {
 // according to the rules for func qualify.
 func rewriteGoFile(name, qual string, paths []string) error {
 	debugln("rewriteGoFile", name, ",", qual, ",", paths)
+	return rewriteImports(name, func(path string) string {
+		return qualify(unqualify(path), qual, paths)
+	})
+}
+
+// rewriteImports replaces each import path p in the named file with
+// rw(p), keeping the file's formatting and sorting the imports if any
+// changed.
+func rewriteImports(name string, rw func(string) string) error {
 	printerConfig := &printer.Config{Mode: printer.TabIndent | printer.UseSpaces, Tabwidth: 8}
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
@@ -83,7 +92,7 @@ func rewriteGoFile(name, qual string, paths []string) error {
 		if err != nil {
 			return err // can't happen
 		}
-		q := qualify(unqualify(name), qual, paths)
+		q := rw(name)
 		if q != name {
 			s.Path.Value = strconv.Quote(q)
 			changed = true
@@ -92,6 +101,10 @@ func rewriteGoFile(name, qual string, paths []string) error {
 	if !changed {
 		return nil
 	}
+	if planning != nil {
+		planning.rewrote(name)
+		return nil
+	}
 	var buffer bytes.Buffer
 	if err = printerConfig.Fprint(&buffer, fset, f); err != nil {
 		return err
@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"bufio"
@@ -19,7 +19,7 @@ import (
 
 var cmdSave = &Command{
 	Name:  "save",
-	Args:  "[-r] [-t] [packages]",
+	Args:  "[-r] [-t] [-flatten] [-force] [-n] [-plan-out file] [-link hard|reflink] [-tags 'tag...'] [-ignoretags 'tag...'] [-targets 'os/arch...'] [packages]",
 	Short: "list and copy dependencies into Godeps",
 	Long: `
 
@@ -38,16 +38,49 @@ The dependency list is a JSON document with the following structure:
 		ImportPath string
 		GoVersion  string   // Abridged output of 'go version'.
 		Packages   []string // Arguments to godep save, if any.
+		Ignore     []string // Import path patterns never to vendor.
+		Tags       []string // Build tags taken to be set when scanning.
+		IgnoreTags []string // Build tags taken to be unset when scanning.
+		Targets    []string // GOOS/GOARCH pairs to find dependencies for.
+		Flatten    bool     // Vendor trees of dependencies are hoisted.
+		Include    []string // Files to copy that would be skipped.
+		Exclude    []string // Files never to copy.
 		Deps       []struct {
 			ImportPath string
-			Comment    string // Tag or description of commit.
-			Rev        string // VCS-specific commit ID.
+			Comment    string   // Tag or description of commit.
+			Rev        string   // VCS-specific commit ID.
+			Patches    []string // Local patches applied, if any.
+			Hold       bool     // Pinned by 'godep hold'.
+			Reason     string   // Why the dependency is held.
+			Targets    []string // Targets that need it, if Targets is set.
+			Include    []string // As above, for this dependency.
+			Exclude    []string
 		}
 	}
 
 Any packages already present in the list will be left unchanged.
 To update a dependency to a newer revision, use 'godep update'.
 
+Changes to the copied source are made in a staging tree next to it,
+which starts out as hard links to the files in place, and swapped into
+place, together with the new Godeps.json, only once all of them have
+succeeded. If save or update is interrupted, the next run of
+either rolls back what was left.
+
+Only files whose contents or mode differ from the copy already in place
+are written, and files no longer in a dependency are deleted, so
+unchanged files keep their modification times. With -v, save reports
+how many files were written, linked, left unchanged and deleted. If
+-link is hard or reflink, files that need no changes (no import comment
+to strip) are hard linked or cloned from GOPATH instead of copied, where
+the filesystem allows; otherwise they are copied as usual. Hard linked
+files share their contents with GOPATH, so edit them only through
+'godep patch'.
+
+Imports matching a pattern in Ignore (patterns are as for update) are
+neither looked up in GOPATH nor copied, along with everything they
+import in turn. Edit Godeps.json by hand to set the list; save keeps it.
+
 If -r is given, import statements will be rewritten to refer directly
 to the copied source code. This is not compatible with the vendor
 experiment. Note that this will not rewrite the statements in the
@@ -56,6 +89,48 @@ files outside the project.
 If -t is given, test files (*_test.go files + testdata directories) are
 also saved.
 
+Otherwise the files copied from a dependency package are those tracked
+by its VCS directly in the package's directory, less test files, plus
+legal files such as LICENSE from its repository. Include and Exclude, for the project or
+for a single dependency, change that with glob patterns as for
+path.Match: a pattern without a slash matches any element of a file's
+path, one with a slash matches from the root of the dependency's
+repository, and a pattern matching a directory matches everything in
+it. The dependency's patterns are tried before the project's, excludes
+before includes, and the first that matches decides; untracked files
+are never copied. Edit Godeps.json by hand to set them; save keeps
+them. To copy a dependency again after changing its patterns, run
+'godep update' on it.
+
+Files are scanned for imports if their //go:build or +build constraint
+can hold. The tags appengine and ignore, and any given to -ignoretags,
+are taken to be false; tags given to -tags are true, goN.M tags hold
+from the recorded go version on, and other tags may be either. If
+-targets is given, imports are collected only from files that build for
+at least one of the listed GOOS/GOARCH pairs, judged by file name suffix
+and constraint, and each dependency records the targets that need it.
+Without -targets, files for every platform are scanned.
+The values given are stored in Godeps.json and used by later runs of
+save, update and diff.
+
+If -flatten is given, the vendor directories of dependencies are not
+copied. The packages in them are vendored at the top level instead,
+from GOPATH if they are there and otherwise from the nested copy, at
+the revision recorded in the Godeps.json of the dependency holding it.
+Save fails, listing the conflicts, if a dependency vendors or keeps in
+its Godeps workspace a package at a revision other than the one used at
+the top level. Flatten is stored in Godeps.json and used by later runs
+of save, update, diff and patch; edit Godeps.json to turn it off.
+
+Save refuses to remove the vendored copy of a dependency no longer
+used if files in it were edited by hand (see 'godep vendor-status'),
+unless -force is given.
+
+If -n is given, save prints what it would do: the dependencies added
+and removed, the files copied and deleted and the imports rewritten.
+If -plan-out is given, the same plan is written to the named file as
+JSON, to be carried out later by 'godep apply'.
+
 For more about specifying packages, see 'go help packages'.
 `,
 	Run:          runSave,
@@ -69,22 +144,23 @@ var (
 func init() {
 	cmdSave.Flag.BoolVar(&saveR, "r", false, "rewrite import paths")
 	cmdSave.Flag.BoolVar(&saveT, "t", false, "save test files")
-
+	cmdSave.Flag.BoolVar(&saveFlatten, "flatten", false, "hoist packages in the vendor trees of dependencies to the top level")
+	cmdSave.Flag.BoolVar(&updateForce, "force", false, "remove vendored files edited by hand")
+	addBuildFlags(&cmdSave.Flag)
+	addCopyFlags(&cmdSave.Flag)
+	addPlanFlags(&cmdSave.Flag)
 }
 
 func runSave(cmd *Command, args []string) {
-	if VendorExperiment && saveR {
+	if vendorExperiment && saveR {
 		log.Println("flag -r is incompatible with the vendoring experiment")
 		cmd.UsageExit()
 	}
-	err := save(args)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	runPlanned(cmd, args, save)
 }
 
 func dotPackage() (*build.Package, error) {
-	dir, err := filepath.Abs(".")
+	dir, err := filepath.Abs(inProject("."))
 	if err != nil {
 		return nil, err
 	}
@@ -104,6 +180,9 @@ func projectPackages(dDir string, a []*Package) []*Package {
 }
 
 func save(pkgs []string) error {
+	if err := recoverTxn(); err != nil {
+		return err
+	}
 	var err error
 	dp, err := dotPackage()
 	if err != nil {
@@ -133,13 +212,27 @@ func save(pkgs []string) error {
 	} else {
 		majorGoVersion, err = trimGoVersion(gold.GoVersion)
 		if err != nil {
-			log.Fatalf("Unable to determine go major version from value specified in %s: %s\n", gold.file(), gold.GoVersion)
+			return fmt.Errorf("Unable to determine go major version from value specified in %s: %s", gold.file(), gold.GoVersion)
 		}
 	}
 
 	gnew := &Godeps{
 		ImportPath: dp.ImportPath,
 		GoVersion:  gold.GoVersion,
+		Ignore:     gold.Ignore,
+		Tags:       gold.Tags,
+		IgnoreTags: gold.IgnoreTags,
+		Targets:    gold.Targets,
+		Flatten:    gold.Flatten || saveFlatten,
+		Include:    gold.Include,
+		Exclude:    gold.Exclude,
+	}
+	ignoreImports = gold.Ignore
+	if err := setBuildConfig(gnew); err != nil {
+		return err
+	}
+	if err := checkLinkMode(); err != nil {
+		return err
 	}
 
 	switch len(pkgs) {
@@ -150,7 +243,7 @@ func save(pkgs []string) error {
 	}
 
 	verboseln("Finding dependencies for", pkgs)
-	a, err := LoadPackages(pkgs...)
+	a, err := loadPackages(pkgs...)
 	if err != nil {
 		return err
 	}
@@ -165,8 +258,11 @@ func save(pkgs []string) error {
 	debugln("Filtered projectPackages")
 	ppln(projA)
 
+	rs := newRepoSession()
+	defer rs.report()
+
 	verboseln("Computing new Godeps.json file")
-	err = gnew.fill(a, dp.ImportPath)
+	err = gnew.fill(rs, a, dp.ImportPath)
 	if err != nil {
 		return err
 	}
@@ -176,8 +272,11 @@ func save(pkgs []string) error {
 	if gnew.Deps == nil {
 		gnew.Deps = make([]Dependency, 0) // produce json [], not null
 	}
+	if err := checkHosts(gnew.Deps); err != nil {
+		return err
+	}
 	gdisk := gnew.copy()
-	err = carryVersions(&gold, gnew)
+	err = carryVersions(rs, &gold, gnew)
 	if err != nil {
 		return err
 	}
@@ -192,15 +291,13 @@ func save(pkgs []string) error {
 		}
 		gold = Godeps{}
 	}
-	os.Remove("Godeps") // remove regular file if present; ignore error
-	readme := filepath.Join("Godeps", "Readme")
-	err = writeFile(readme, strings.TrimSpace(Readme)+"\n")
-	if err != nil {
-		log.Println(err)
-	}
-	_, err = gnew.save()
-	if err != nil {
-		return err
+	if planning == nil {
+		os.Remove(inProject("Godeps")) // remove regular file if present; ignore error
+		readme := inProject(filepath.Join("Godeps", "Readme"))
+		err = writeFile(readme, strings.TrimSpace(Readme)+"\n")
+		if err != nil {
+			log.Println(err)
+		}
 	}
 
 	verboseln("Computing diff between old and new deps")
@@ -208,34 +305,53 @@ func save(pkgs []string) error {
 	// ignores this directory when traversing packages
 	// starting at the project's root. For example,
 	//   godep go list ./...
-	srcdir := filepath.FromSlash(strings.Trim(sep, "/"))
+	srcdir := inProject(filepath.FromSlash(strings.Trim(sep, "/")))
+	var perr error // patch conflicts, reported once everything else is done
 	rem := subDeps(gold.Deps, gnew.Deps)
 	ppln(rem)
 	add := subDeps(gnew.Deps, gold.Deps)
 	ppln(add)
-	if len(rem) > 0 {
-		verboseln("Deps to remove:")
-		for _, r := range rem {
-			verboseln("\t", r.ImportPath)
+	planning.deps(gold.Deps, gnew.Deps)
+	if len(rem) == 0 && len(add) == 0 {
+		if planning == nil {
+			_, err = gnew.save()
+			if err != nil {
+				return err
+			}
 		}
-		verboseln("Removing unused dependencies")
-		err = removeSrc(srcdir, rem)
+	} else {
+		if err := checkVendorEdits(rs, rem, nil); err != nil {
+			return err
+		}
+		// Make the changes in a copy of srcdir, swapped in
+		// only once everything has worked.
+		txn, err := startTxn("save", srcdir, gnew.file())
 		if err != nil {
 			return err
 		}
-	}
-	if len(add) > 0 {
-		verboseln("Deps to add:")
-		for _, a := range add {
-			verboseln("\t", a.ImportPath)
+		defer txn.abort()
+		perr, err = saveSrc(rs, txn.Stage, gnew, rem, add)
+		if err != nil {
+			return err
+		}
+		if planning != nil {
+			err = planning.staged(srcdir, txn.Stage)
+		} else {
+			err = txn.commit(gnew)
 		}
-		verboseln("Adding new dependencies")
-		err = copySrc(srcdir, add)
 		if err != nil {
 			return err
 		}
+		if planning == nil {
+			for _, d := range rem {
+				depResult("remove", d, nil)
+			}
+			for _, d := range add {
+				depResult("save", d, nil)
+			}
+		}
 	}
-	if !VendorExperiment {
+	if !vendorExperiment && planning == nil {
 		f, _ := filepath.Split(srcdir)
 		writeVCSIgnore(f)
 	}
@@ -247,7 +363,54 @@ func save(pkgs []string) error {
 	}
 	verboseln("Rewriting paths (if necessary)")
 	ppln(rewritePaths)
-	return rewrite(projA, dp.ImportPath, rewritePaths)
+	err = rewrite(projA, dp.ImportPath, rewritePaths)
+	if err != nil {
+		return err
+	}
+	if planning != nil && planning.stage != "" && hasFilePathPrefix(srcdir, inProject("Godeps")) {
+		// The stage of a dry run is not under Godeps.
+		err = rewriteTree(planning.stage, dp.ImportPath, rewritePaths)
+		if err != nil {
+			return err
+		}
+	}
+	return perr
+}
+
+// saveSrc removes rem from and adds add to the source tree in dir,
+// applying any local patches and recording them in g. It returns
+// errorPatchConflicts as perr if some patches did not apply.
+func saveSrc(s *repoSession, dir string, g *Godeps, rem, add []Dependency) (perr, err error) {
+	if len(rem) > 0 {
+		verboseln("Deps to remove:")
+		for _, r := range rem {
+			verboseln("\t", r.ImportPath)
+		}
+		verboseln("Removing unused dependencies")
+		err = removeSrc(dir, rem)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(add) > 0 {
+		verboseln("Deps to add:")
+		for _, a := range add {
+			verboseln("\t", a.ImportPath)
+		}
+		verboseln("Adding new dependencies")
+		err = copySrc(s, dir, add)
+		if err != nil {
+			return nil, err
+		}
+		verboseln("Applying local patches")
+		applied, err := applyPatches(dir, add)
+		if err != nil && err != errorPatchConflicts {
+			return nil, err
+		}
+		perr = err
+		setPatches(g.Deps, applied)
+	}
+	return perr, nil
 }
 
 func printVersionWarnings(ov string) {
@@ -288,14 +451,17 @@ func (v *revError) Error() string {
 		"Run `godep update %s' first.", v.ImportPath, v.WantRev, v.HavePath, v.HaveRev, v.HavePath)
 }
 
-// carryVersions copies Rev and Comment from a to b for
-// each dependency with an identical ImportPath. For any
-// dependency in b that appears to be from the same repo
-// as one in a (for example, a parent or child directory),
-// the Rev must already match - otherwise it is an error.
-func carryVersions(a, b *Godeps) error {
+func (v *revError) code() string { return "rev-conflict" }
+
+// carryVersions copies Rev, Comment, Patches, Hold, Reason and the
+// Include and Exclude patterns from a to b for each dependency with
+// an identical ImportPath. For any dependency in b that appears to
+// be from the same repo as one in a (for example, a parent or child
+// directory), the Rev must already match - otherwise it is an error.
+// Repositories are identified through s.
+func carryVersions(s *repoSession, a, b *Godeps) error {
 	for i := range b.Deps {
-		err := carryVersion(a, &b.Deps[i])
+		err := carryVersion(s, a, &b.Deps[i])
 		if err != nil {
 			return err
 		}
@@ -303,12 +469,17 @@ func carryVersions(a, b *Godeps) error {
 	return nil
 }
 
-func carryVersion(a *Godeps, db *Dependency) error {
+func carryVersion(s *repoSession, a *Godeps, db *Dependency) error {
 	// First see if this exact package is already in the list.
 	for _, da := range a.Deps {
 		if db.ImportPath == da.ImportPath {
 			db.Rev = da.Rev
 			db.Comment = da.Comment
+			db.Patches = da.Patches
+			db.Hold = da.Hold
+			db.Reason = da.Reason
+			db.Include = da.Include
+			db.Exclude = da.Exclude
 			return nil
 		}
 	}
@@ -317,7 +488,7 @@ func carryVersion(a *Godeps, db *Dependency) error {
 	// the same repo, so report that as an error.
 	for _, da := range a.Deps {
 		if strings.HasPrefix(db.ImportPath, da.ImportPath+"/") ||
-			strings.HasPrefix(da.ImportPath, db.root+"/") {
+			(db.root != "" && s.rootOf(da.ImportPath) == db.root) {
 			if da.Rev != db.Rev {
 				return &revError{
 					ImportPath: db.ImportPath,
@@ -357,14 +528,29 @@ func removeSrc(srcdir string, deps []Dependency) error {
 	return nil
 }
 
-func copySrc(dir string, deps []Dependency) error {
+// copySrc copies deps into dir. Only files that differ from what is
+// already in dir are written, and files no longer in a dependency are
+// deleted.
+func copySrc(s *repoSession, dir string, deps []Dependency) error {
+	copied = copyCounts{keep: make(map[string]bool)}
+	defer func() { copied.keep = nil }()
 	// mapping to see if we visited a parent directory already
 	visited := make(map[string]bool)
+	var roots []string // package roots copied into dir
 	ok := true
 	for _, dep := range deps {
+		if isIgnored(dep.ImportPath) {
+			verboseln("ignored, not copying:", dep.ImportPath)
+			continue
+		}
 		debugln("copySrc for", dep.ImportPath)
 		srcdir := filepath.Join(dep.ws, "src")
-		rel, err := filepath.Rel(srcdir, dep.dir)
+		pkgsrc := srcdir // what import paths are relative to
+		if dep.vendored != "" {
+			// Hoisted from a nested vendor tree by -flatten.
+			pkgsrc = strings.TrimSuffix(dep.dir, string(filepath.Separator)+filepath.FromSlash(dep.ImportPath))
+		}
+		rel, err := filepath.Rel(pkgsrc, dep.dir)
 		debugln("srcdir", srcdir)
 		debugln("rel", rel)
 		debugln("err", err)
@@ -372,18 +558,25 @@ func copySrc(dir string, deps []Dependency) error {
 			return err
 		}
 		dstpkgroot := filepath.Join(dir, rel)
-		err = os.RemoveAll(dstpkgroot)
+		repo, err := s.repo(dep.dir, srcdir)
 		if err != nil {
 			log.Println(err)
 			ok = false
+			continue
 		}
+		roots = append(roots, dstpkgroot)
 
 		// copy actual dependency
-		vf := dep.vcs.listFiles(dep.dir)
+		rootdir := filepath.Join(pkgsrc, filepath.FromSlash(dep.root))
+		ff := newFileFilter(&dep, rootdir, dep.dir)
+		vf := repo.listFiles(dep.dir)
+		if ff.hasIncludes() {
+			vf = repo.listTree(dep.dir)
+		}
 		debugln("vf", vf)
 		w := fs.Walk(dep.dir)
 		for w.Step() {
-			err = copyPkgFile(vf, dir, srcdir, w)
+			err = copyPkgFile(vf, dir, pkgsrc, w, ff)
 			if err != nil {
 				log.Println(err)
 				ok = false
@@ -403,17 +596,17 @@ func copySrc(dir string, deps []Dependency) error {
 		//   two subpackages listed someorg/common and
 		//   someorg/anotherpack which has their license in
 		//   the parent dir of someorg
-		rootdir := filepath.Join(srcdir, filepath.FromSlash(dep.root))
 		if visited[rootdir] {
 			continue
 		}
 		visited[rootdir] = true
-		vf = dep.vcs.listFiles(rootdir)
+		vf = repo.listFiles(rootdir)
 		w = fs.Walk(rootdir)
+		ff = newFileFilter(&dep, rootdir, "")
 		for w.Step() {
 			fname := filepath.Base(w.Path())
 			if IsLegalFile(fname) && !strings.Contains(w.Path(), sep) {
-				err = copyPkgFile(vf, dir, srcdir, w)
+				err = copyPkgFile(vf, dir, srcdir, w, ff)
 				if err != nil {
 					log.Println(err)
 					ok = false
@@ -422,6 +615,16 @@ func copySrc(dir string, deps []Dependency) error {
 		}
 	}
 
+	for _, root := range roots {
+		if err := pruneTree(root, copied.keep); err != nil {
+			log.Println(err)
+			ok = false
+		}
+	}
+	if verbose {
+		log.Printf("Copied %d dependencies: %s\n", len(roots), copied)
+	}
+
 	if !ok {
 		return errorCopyingSourceCode
 	}
@@ -429,16 +632,28 @@ func copySrc(dir string, deps []Dependency) error {
 	return nil
 }
 
-func copyPkgFile(vf vcsFiles, dstroot, srcroot string, w *fs.Walker) error {
+func copyPkgFile(vf vcsFiles, dstroot, srcroot string, w *fs.Walker, ff fileFilter) error {
 	if w.Err() != nil {
 		return w.Err()
 	}
 	name := w.Stat().Name()
 	if w.Stat().IsDir() {
-		if name[0] == '.' || name[0] == '_' || (!saveT && name == "testdata") {
+		switch {
+		case name == ".git" || name == ".hg" || name == ".bzr" || name == ".svn":
+			w.SkipDir()
+		case flattenVendor && name == "vendor":
+			// Packages in nested vendor trees are hoisted to the top.
+			verboseln("flatten: skipping", w.Path())
+			w.SkipDir()
+		case ff.hasIncludes():
+			// A file below may be included; decide file by file.
+		case !ff.fixed(w.Path(), true):
 			// Skip directories starting with '.' or '_' or
 			// 'testdata' (last is only skipped if saveT is false)
 			w.SkipDir()
+		case !ff.decide(ff.rel(w.Path()), true):
+			verboseln("save: excluding", w.Path())
+			w.SkipDir()
 		}
 		return nil
 	}
@@ -446,9 +661,15 @@ func copyPkgFile(vf vcsFiles, dstroot, srcroot string, w *fs.Walker) error {
 	if err != nil { // this should never happen
 		return err
 	}
-	if !saveT && strings.HasSuffix(name, "_test.go") {
+	fixed := ff.fixed(w.Path(), false)
+	if !ff.decide(ff.rel(w.Path()), fixed) {
 		if verbose {
-			log.Printf("save: skipping test file: %s", w.Path())
+			switch {
+			case fixed:
+				log.Printf("save: excluding file: %s", w.Path())
+			case strings.HasSuffix(name, "_test.go"):
+				log.Printf("save: skipping test file: %s", w.Path())
+			}
 		}
 		return nil
 	}
@@ -461,21 +682,35 @@ func copyPkgFile(vf vcsFiles, dstroot, srcroot string, w *fs.Walker) error {
 	return copyFile(filepath.Join(dstroot, rel), w.Path())
 }
 
-// copyFile copies a regular file from src to dst.
-// dst is opened with os.Create.
+// copyFile copies a regular file or symlink from src to dst,
+// unless dst already has the same contents and mode.
+// dst is replaced by way of a temporary file.
 // If the file name ends with .go,
 // copyFile strips canonical import path annotations.
 // These are comments of the form:
 //   package foo // import "bar/foo"
 //   package foo /* import "bar/foo" */
+// Files that need no such change are linked instead of copied
+// if linkMode asks for it.
 func copyFile(dst, src string) error {
 	err := os.MkdirAll(filepath.Dir(dst), 0777)
 	if err != nil {
 		return err
 	}
+	if copied.keep != nil {
+		copied.keep[dst] = true
+	}
 
 	linkDst, err := os.Readlink(src)
 	if err == nil {
+		if old, err := os.Readlink(dst); err == nil && old == linkDst {
+			copied.unchanged++
+			return nil
+		}
+		if err := removeIfExists(dst); err != nil {
+			return err
+		}
+		copied.written++
 		return os.Symlink(linkDst, dst)
 	}
 
@@ -483,34 +718,34 @@ func copyFile(dst, src string) error {
 	if err != nil {
 		return err
 	}
-
-	r, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	w, err := os.Create(dst)
+	data, same, err := vendorContents(src)
 	if err != nil {
 		return err
 	}
-	if err := os.Chmod(dst, si.Mode()); err != nil {
-		return err
+	if sameContents(dst, si.Mode(), data) {
+		debugln("Unchanged", dst)
+		copied.unchanged++
+		return nil
 	}
 
-	if strings.HasSuffix(dst, ".go") {
-		debugln("Copy Without Import Comment", w, r)
-		err = copyWithoutImportComment(w, r)
-	} else {
-		debugln("Copy (plain)", w, r)
-		_, err = io.Copy(w, r)
-	}
-	err1 := w.Close()
-	if err == nil {
-		err = err1
+	if linkMode != "" && same {
+		tmp := dst + ".godep-tmp"
+		os.Remove(tmp)
+		err := linkFile(tmp, src)
+		if err == nil {
+			err = os.Rename(tmp, dst)
+		}
+		if err == nil {
+			debugln("Linked", dst)
+			copied.linked++
+			return nil
+		}
+		os.Remove(tmp)
+		debugln("Unable to link", src, "so copying:", err)
 	}
-
-	return err
+	debugln("Copy", dst)
+	copied.written++
+	return replaceFile(dst, si.Mode(), data)
 }
 
 func copyWithoutImportComment(w io.Writer, r io.Reader) error {
@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"bytes"
@@ -70,10 +70,6 @@ func setGOPATH(paths ...string) {
 	build.Default.GOPATH = strings.Join(paths, string(os.PathListSeparator))
 }
 
-func clearPkgCache() {
-	pkgCache = make(map[string]*build.Package)
-}
-
 func godeps(importpath string, keyval ...string) *Godeps {
 	g := &Godeps{
 		ImportPath: importpath,
@@ -90,8 +86,8 @@ func godeps(importpath string, keyval ...string) *Godeps {
 func setGlobals(vendor bool) {
 	clearPkgCache()
 	clearStatCache()
-	VendorExperiment = vendor
-	sep = defaultSep(VendorExperiment)
+	vendorExperiment = vendor
+	sep = defaultSep(vendorExperiment)
 	//debug = testing.Verbose()
 	//verbose = testing.Verbose()
 }
@@ -102,6 +98,7 @@ func TestSave(t *testing.T) {
 		args     []string
 		flagR    bool
 		flagT    bool
+		flatten  bool
 		vendor   bool
 		start    []*node
 		altstart []*node
@@ -1573,6 +1570,366 @@ func TestSave(t *testing.T) {
 				},
 			},
 		},
+		{ // 40 - ignored packages need not exist and are not copied
+			cwd: "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E"), nil},
+						{"Godeps/Godeps.json", &Godeps{ImportPath: "C", Ignore: []string{"E", "F/..."}}, nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "F/sub"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "D", "E"), nil},
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D", "F/sub"), nil},
+				{"C/Godeps/_workspace/src/E/main.go", "(absent)", nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Ignore:     []string{"E", "F/..."},
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
+		{ // 41 - imports are collected per target and recorded on each dependency
+			cwd: "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"main_windows.go", pkg("main", "E"), nil},
+						{"main_plan9.go", pkg("main", "F"), nil},
+						{"unix.go", "// +build linux darwin\n\n" + pkg("main", "G"), nil},
+						{"Godeps/Godeps.json", &Godeps{ImportPath: "C", Targets: []string{"linux/amd64", "windows/386"}}, nil},
+						{"+git", "", nil},
+					},
+				},
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{"E", "", []*node{{"main.go", pkg("E"), nil}, {"+git", "E1", nil}}},
+				{"F", "", []*node{{"main.go", pkg("F"), nil}, {"+git", "F1", nil}}},
+				{"G", "", []*node{{"main.go", pkg("G"), nil}, {"+git", "G1", nil}}},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+				{"C/Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+				{"C/Godeps/_workspace/src/F/main.go", "(absent)", nil},
+				{"C/Godeps/_workspace/src/G/main.go", pkg("G"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1", Targets: []string{"linux/amd64", "windows/386"}},
+					{ImportPath: "E", Comment: "E1", Targets: []string{"windows/386"}},
+					{ImportPath: "G", Comment: "G1", Targets: []string{"linux/amd64"}},
+				},
+			},
+		},
+		{ // 42 - build constraints are evaluated, not searched for tags
+			cwd: "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"notae.go", "//go:build !appengine\n\n" + pkg("main", "E"), nil},
+						{"gen.go", "//go:build ignore\n\n" + pkg("main", "F"), nil},
+						{"old.go", "// +build linux,!go1.1\n\n" + pkg("main", "G"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{"E", "", []*node{{"main.go", pkg("E"), nil}, {"+git", "E1", nil}}},
+				{"F", "", []*node{{"main.go", pkg("F"), nil}, {"+git", "F1", nil}}},
+				{"G", "", []*node{{"main.go", pkg("G"), nil}, {"+git", "G1", nil}}},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+				{"C/Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+				{"C/Godeps/_workspace/src/F/main.go", "(absent)", nil},
+				{"C/Godeps/_workspace/src/G/main.go", "(absent)", nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+		},
+		{ // 43 - flatten hoists nested vendor packages and strips the copies
+			cwd:     "C",
+			vendor:  true,
+			flatten: true,
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "F"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "E", "F"), nil},
+						{"vendor/E/main.go", pkg("E"), nil},
+						{"vendor/F/main.go", pkg("F") + decl("nested"), nil},
+						{"Godeps/Godeps.json", `{"ImportPath": "D", "Deps": [{"ImportPath": "E", "Comment": "v1", "Rev": "e1"}]}`, nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{"F", "", []*node{{"main.go", pkg("F"), nil}, {"+git", "F1", nil}}},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D", "E", "F"), nil},
+				{"C/vendor/D/vendor/E/main.go", "(absent)", nil},
+				{"C/vendor/D/vendor/F/main.go", "(absent)", nil},
+				{"C/vendor/E/main.go", pkg("E"), nil},
+				{"C/vendor/F/main.go", pkg("F"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Flatten:    true,
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "E", Comment: "v1"},
+					{ImportPath: "F", Comment: "F1"},
+				},
+			},
+		},
+		{ // 44 - flatten fails if a nested copy is at another revision
+			cwd:     "C",
+			vendor:  true,
+			flatten: true,
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "F"), nil},
+						{"Godeps/Godeps.json", &Godeps{ImportPath: "C"}, nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "F"), nil},
+						{"vendor/F/main.go", pkg("F"), nil},
+						{"Godeps/Godeps.json", `{"ImportPath": "D", "Deps": [{"ImportPath": "F", "Rev": "f0"}]}`, nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{"F", "", []*node{{"main.go", pkg("F"), nil}, {"+git", "F1", nil}}},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", "(absent)", nil},
+				{"C/vendor/F/main.go", "(absent)", nil},
+			},
+			wdep: Godeps{ImportPath: "C"},
+			werr: true,
+		},
+		{ // 45 - include and exclude patterns
+			cwd: "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", &Godeps{ImportPath: "C", Include: []string{"_asm", "testdata/small.dat"}, Exclude: []string{"examples", "*.pb"}}, nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"d.proto", "message D {}\n", nil},
+						{"d.pb", "binary\n", nil},
+						{"_asm/d.s", "TEXT\n", nil},
+						{"examples/ex.go", pkg("main"), nil},
+						{"testdata/small.dat", "small\n", nil},
+						{"testdata/big.dat", "big\n", nil},
+						{"+git", "D1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+				{"C/Godeps/_workspace/src/D/d.proto", "message D {}\n", nil},
+				{"C/Godeps/_workspace/src/D/d.pb", "(absent)", nil},
+				{"C/Godeps/_workspace/src/D/_asm/d.s", "TEXT\n", nil},
+				{"C/Godeps/_workspace/src/D/examples/ex.go", "(absent)", nil},
+				{"C/Godeps/_workspace/src/D/testdata/small.dat", "small\n", nil},
+				{"C/Godeps/_workspace/src/D/testdata/big.dat", "(absent)", nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
+		{ // 46 - unused dependency edited by hand is not removed
+			cwd:    "C",
+			vendor: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1", "E", "E1"), nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"vendor/E/main.go", pkg("E") + decl("Local"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/E/main.go", pkg("E") + decl("Local"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+			werr: true,
+		},
+		{ // 47 - save keeps holds
+			cwd:    "C",
+			vendor: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", &Godeps{
+							ImportPath: "C",
+							Deps: []Dependency{
+								{ImportPath: "D", Comment: "D1", Hold: true, Reason: "pinned"},
+							},
+						}, nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "D"), nil},
+				{"C/vendor/D/main.go", pkg("D"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1", Hold: true, Reason: "pinned"},
+				},
+			},
+		},
+		{ // 48 - unparseable GoVersion is an error
+			cwd:    "C",
+			vendor: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", &Godeps{ImportPath: "C", GoVersion: "gox"}, nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor", "(absent)", nil},
+			},
+			wdep: Godeps{ImportPath: "C"},
+			werr: true,
+		},
+		{ // 49 - +build in a doc comment is not a constraint
+			cwd:    "C",
+			vendor: true,
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"doc.go", "// Package main is never built with\n// +build ignore\npackage main\n\nimport _ \"E\"\n", nil},
+						{"+git", "", nil},
+					},
+				},
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{"E", "", []*node{{"main.go", pkg("E"), nil}, {"+git", "E1", nil}}},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D"), nil},
+				{"C/vendor/E/main.go", pkg("E"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+		},
 	}
 
 	wd, err := os.Getwd()
@@ -1604,6 +1961,7 @@ func TestSave(t *testing.T) {
 		setGOPATH(root1, root2)
 		saveR = test.flagR
 		saveT = test.flagT
+		saveFlatten = test.flatten
 		err = save(test.args)
 		if g := err != nil; g != test.werr {
 			if err != nil {
@@ -1638,7 +1996,14 @@ func TestSave(t *testing.T) {
 		if !reflect.DeepEqual(g.Deps, test.wdep.Deps) {
 			t.Errorf("%d Deps = %v want %v", pos, g.Deps, test.wdep.Deps)
 		}
+		if !reflect.DeepEqual(g.Ignore, test.wdep.Ignore) {
+			t.Errorf("%d Ignore = %v want %v", pos, g.Ignore, test.wdep.Ignore)
+		}
+		if g.Flatten != test.wdep.Flatten {
+			t.Errorf("%d Flatten = %v want %v", pos, g.Flatten, test.wdep.Flatten)
+		}
 	}
+	saveFlatten = false
 }
 
 func makeTree(t *testing.T, tree *node, altpath string) (gopath string) {
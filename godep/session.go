@@ -0,0 +1,191 @@
+package godep
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// repoSession memoizes VCS queries for the duration of a single godep
+// invocation. Results are keyed by repository root, so the packages of
+// a repository share one identify, one dirty check, one describe and
+// one listing of tracked files.
+type repoSession struct {
+	repos map[string]*repoState // absolute repo root => state
+	dirs  map[string]*repoState // package dir => state
+	stats map[string]*repoStat  // operation => timing
+}
+
+type repoStat struct {
+	runs, hits int
+	took       time.Duration
+}
+
+// repoState is what a session knows about one repository.
+type repoState struct {
+	s    *repoSession
+	vcs  *VCS
+	dir  string // absolute path of the repository root
+	root string // import path of the repository root
+
+	id     string
+	idErr  error
+	hasID  bool
+	dirty  map[string]bool   // rev => working tree differs
+	desc   map[string]string // rev => description
+	files  vcsFiles          // all tracked files, nil until listed
+	byDir  map[string]vcsFiles
+	listed bool
+}
+
+func newRepoSession() *repoSession {
+	return &repoSession{
+		repos: make(map[string]*repoState),
+		dirs:  make(map[string]*repoState),
+		stats: make(map[string]*repoStat),
+	}
+}
+
+// track records that op ran (or was answered from cache when hit is true).
+func (s *repoSession) track(op string, start time.Time, hit bool) {
+	st := s.stats[op]
+	if st == nil {
+		st = new(repoStat)
+		s.stats[op] = st
+	}
+	if hit {
+		st.hits++
+		return
+	}
+	st.runs++
+	st.took += time.Since(start)
+}
+
+// repo returns the repository containing the package in dir.
+// srcRoot is the GOPATH src directory dir lives in.
+func (s *repoSession) repo(dir, srcRoot string) (*repoState, error) {
+	start := time.Now()
+	if r, ok := s.dirs[dir]; ok {
+		s.track("inspect", start, true)
+		return r, nil
+	}
+	vcs, reporoot, err := VCSFromDir(dir, srcRoot)
+	s.track("inspect", start, false)
+	if err != nil {
+		return nil, err
+	}
+	rdir := filepath.Join(srcRoot, reporoot)
+	r, ok := s.repos[rdir]
+	if !ok {
+		r = &repoState{
+			s:     s,
+			vcs:   vcs,
+			dir:   rdir,
+			root:  filepath.ToSlash(reporoot),
+			dirty: make(map[string]bool),
+			desc:  make(map[string]string),
+		}
+		s.repos[rdir] = r
+	}
+	s.dirs[dir] = r
+	return r, nil
+}
+
+// rootOf returns the import path of the innermost repository seen by
+// the session that contains importPath, or "" if there is none.
+func (s *repoSession) rootOf(importPath string) string {
+	var root string
+	for _, r := range s.repos {
+		if len(r.root) > len(root) && (importPath == r.root || strings.HasPrefix(importPath, r.root+"/")) {
+			root = r.root
+		}
+	}
+	return root
+}
+
+func (r *repoState) identify() (string, error) {
+	start := time.Now()
+	if r.hasID {
+		r.s.track("identify", start, true)
+		return r.id, r.idErr
+	}
+	r.id, r.idErr = r.vcs.identify(r.dir)
+	r.hasID = true
+	r.s.track("identify", start, false)
+	return r.id, r.idErr
+}
+
+func (r *repoState) isDirty(rev string) bool {
+	start := time.Now()
+	if d, ok := r.dirty[rev]; ok {
+		r.s.track("diff", start, true)
+		return d
+	}
+	d := r.vcs.isDirty(r.dir, rev)
+	r.dirty[rev] = d
+	r.s.track("diff", start, false)
+	return d
+}
+
+func (r *repoState) describe(rev string) string {
+	start := time.Now()
+	if d, ok := r.desc[rev]; ok {
+		r.s.track("describe", start, true)
+		return d
+	}
+	d := r.vcs.describe(r.dir, rev)
+	r.desc[rev] = d
+	r.s.track("describe", start, false)
+	return d
+}
+
+// listFiles returns the tracked files directly inside dir, which must be
+// in the repository. The repository is listed once, in full.
+func (r *repoState) listFiles(dir string) vcsFiles {
+	start := time.Now()
+	if !r.listed {
+		r.files = r.vcs.listAllFiles(r.dir)
+		r.listed = true
+		r.byDir = make(map[string]vcsFiles)
+		r.s.track("list", start, false)
+	} else {
+		r.s.track("list", start, true)
+	}
+	vf, ok := r.byDir[dir]
+	if !ok {
+		vf = r.files.inDir(dir)
+		r.byDir[dir] = vf
+	}
+	return vf
+}
+
+// listTree returns the tracked files anywhere under dir.
+func (r *repoState) listTree(dir string) vcsFiles {
+	r.listFiles(dir) // make sure the repository is listed
+	files := make(vcsFiles)
+	for path := range r.files {
+		if hasFilePathPrefix(path, dir) {
+			files[path] = true
+		}
+	}
+	return files
+}
+
+// report logs a summary of the VCS work done in the session.
+func (s *repoSession) report() {
+	if !verbose || len(s.stats) == 0 {
+		return
+	}
+	var ops []string
+	for op := range s.stats {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	log.Printf("VCS queries for %d repositories:", len(s.repos))
+	for _, op := range ops {
+		st := s.stats[op]
+		log.Printf("\t%-8s %4d run, %4d cached, %v\n", op, st.runs, st.hits, st.took)
+	}
+}
@@ -0,0 +1,79 @@
+package godep
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepoSession(t *testing.T) {
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	err := os.RemoveAll(scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(wd, scratch, "src")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D"), nil},
+				{"P/main.go", pkg("P"), nil},
+				{"Q/main.go", pkg("Q"), nil},
+				{"+git", "D1", nil},
+			},
+		},
+	}}, "")
+
+	s := newRepoSession()
+	var ids []string
+	for _, p := range []string{"D", "D/P", "D/Q"} {
+		dir := filepath.Join(src, filepath.FromSlash(p))
+		r, err := s.repo(dir, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.root != "D" {
+			t.Errorf("repo(%s).root = %q want %q", p, r.root, "D")
+		}
+		id, err := r.identify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		if r.isDirty(id) {
+			t.Errorf("repo(%s) is dirty", p)
+		}
+		if d := r.describe(id); d != "D1" {
+			t.Errorf("describe(%s) = %q want %q", p, d, "D1")
+		}
+		vf := r.listFiles(dir)
+		if len(vf) != 1 || !vf.Contains(filepath.Join(dir, "main.go")) {
+			t.Errorf("listFiles(%s) = %v", p, vf)
+		}
+	}
+	if ids[0] != ids[1] || ids[1] != ids[2] {
+		t.Errorf("ids = %v, want all equal", ids)
+	}
+	if len(s.repos) != 1 {
+		t.Errorf("len(repos) = %d want 1", len(s.repos))
+	}
+	for _, op := range []string{"identify", "diff", "describe", "list"} {
+		st := s.stats[op]
+		if st == nil || st.runs != 1 || st.hits != 2 {
+			t.Errorf("stats[%s] = %+v want 1 run, 2 hits", op, st)
+		}
+	}
+	if g := s.rootOf("D/P/X"); g != "D" {
+		t.Errorf("rootOf(D/P/X) = %q want %q", g, "D")
+	}
+	if g := s.rootOf("DX"); g != "" {
+		t.Errorf("rootOf(DX) = %q want %q", g, "")
+	}
+}
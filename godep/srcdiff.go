@@ -0,0 +1,231 @@
+package godep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// srcTree is the vendored files of some packages, keyed by slash
+// separated import path (for example, D/main.go).
+type srcTree map[string]srcBlob
+
+type srcBlob struct {
+	data []byte
+	rev  string // revision the file was read at, or "GOPATH"
+}
+
+// srcStat is the lines added and removed in one package.
+type srcStat struct {
+	files, added, removed int
+}
+
+// srcDiff writes to w a unified diff of the files vendored for the
+// dependencies at or below pkg, as recorded in Godeps.json, between
+// revs[0] and revs[1], or, if revs is empty, between the revision in
+// Godeps.json and the working tree in GOPATH. It then writes a summary
+// of the lines added and removed in each package, and reports whether
+// anything differs.
+func srcDiff(w io.Writer, pkg string, revs []string) (bool, error) {
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return false, err
+	}
+	ignoreImports = g.Ignore
+	if err := setBuildConfig(&g); err != nil {
+		return false, err
+	}
+	pkg = strings.TrimSuffix(pkg, "/")
+	var deps []Dependency
+	for _, d := range g.Deps {
+		if containsPathPrefix([]string{pkg}, d.ImportPath) {
+			deps = append(deps, d)
+		}
+	}
+	if len(deps) == 0 {
+		return false, errNoSuchDep(pkg)
+	}
+
+	s := newRepoSession()
+	from, to := make(srcTree), make(srcTree)
+	for _, d := range deps {
+		ps, err := loadPackages(d.ImportPath)
+		if err != nil {
+			return false, err
+		}
+		p := ps[0]
+		if p.Error.Err != "" {
+			return false, fmt.Errorf("%s: %s", d.ImportPath, p.Error.Err)
+		}
+		repo, err := s.repo(p.Dir, filepath.Join(p.Root, "src"))
+		if err != nil {
+			return false, err
+		}
+		d.dir, d.root = p.Dir, repo.root
+		fromRev, toRev := d.Rev, ""
+		if len(revs) == 2 {
+			fromRev, toRev = revs[0], revs[1]
+		}
+		if err := readSrcTree(from, repo, &d, fromRev); err != nil {
+			return false, err
+		}
+		if err := readSrcTree(to, repo, &d, toRev); err != nil {
+			return false, err
+		}
+	}
+
+	var names []string
+	for name := range from {
+		names = append(names, name)
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	stats := make(map[string]*srcStat)
+	for _, name := range names {
+		a, b := from[name], to[name]
+		if (a.data == nil) == (b.data == nil) && string(a.data) == string(b.data) {
+			continue
+		}
+		from, to := "/dev/null", "/dev/null"
+		if a.data != nil {
+			from = name + "@" + a.rev
+		}
+		if b.data != nil {
+			to = name + "@" + b.rev
+		}
+		var buf bytes.Buffer
+		if err := writeDiff(&buf, from, to, a.data, b.data); err != nil {
+			return false, err
+		}
+		diff := buf.String()
+		fmt.Fprint(w, diff)
+		st := stats[path.Dir(name)]
+		if st == nil {
+			st = new(srcStat)
+			stats[path.Dir(name)] = st
+		}
+		st.files++
+		for _, l := range strings.Split(diff, "\n")[2:] {
+			switch {
+			case strings.HasPrefix(l, "+"):
+				st.added++
+			case strings.HasPrefix(l, "-"):
+				st.removed++
+			}
+		}
+	}
+
+	var pkgs []string
+	for p := range stats {
+		pkgs = append(pkgs, p)
+	}
+	sort.Strings(pkgs)
+	for _, p := range pkgs {
+		st := stats[p]
+		files := "files"
+		if st.files == 1 {
+			files = "file"
+		}
+		fmt.Fprintf(w, "%s: %d %s changed, +%d -%d\n", p, st.files, files, st.added, st.removed)
+	}
+	if len(pkgs) == 0 {
+		fmt.Fprintln(w, "no changes")
+	}
+	return len(pkgs) > 0, nil
+}
+
+// readSrcTree adds to t the files copySrc would vendor for d from repo
+// as of rev, or from the working tree if rev is "".
+func readSrcTree(t srcTree, repo *repoState, d *Dependency, rev string) error {
+	files, err := vendoredFiles(repo, d, rev)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		b, err := readSrcFile(repo, rev, f)
+		if err != nil {
+			return err
+		}
+		t[srcKey(repo, f)] = b
+	}
+	return nil
+}
+
+// vendoredFiles returns the files copySrc would vendor for d from repo as of
+// rev, or from the working tree if rev is "", as paths in GOPATH.
+func vendoredFiles(repo *repoState, d *Dependency, rev string) ([]string, error) {
+	var files []string
+	if rev == "" {
+		for f := range repo.listTree(repo.dir) {
+			files = append(files, f)
+		}
+	} else {
+		rel, err := repo.vcs.listRev(repo.dir, rev)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list %s at %s: %v", d.ImportPath, rev, err)
+		}
+		for _, f := range rel {
+			files = append(files, filepath.Join(repo.dir, filepath.FromSlash(f)))
+		}
+	}
+	pf := newFileFilter(d, repo.dir, d.dir)
+	lf := newFileFilter(d, repo.dir, "")
+	var keep []string
+	for _, f := range files {
+		// Legal files come from anywhere in the repository, as in copySrc.
+		legal := d.ImportPath != d.root && IsLegalFile(filepath.Base(f)) &&
+			!strings.Contains(filepath.ToSlash(f), sep) && lf.copies(f)
+		if pf.copies(f) || legal {
+			keep = append(keep, f)
+		}
+	}
+	sort.Strings(keep)
+	return keep, nil
+}
+
+// readSrcFile returns what the file f of repo becomes when vendored, as
+// of rev, or from the working tree if rev is "".
+func readSrcFile(repo *repoState, rev, f string) (srcBlob, error) {
+	rel, err := filepath.Rel(repo.dir, f)
+	if err != nil {
+		return srcBlob{}, err
+	}
+	rel = filepath.ToSlash(rel)
+	var raw []byte
+	desc := "GOPATH"
+	if rev == "" {
+		raw, err = ioutil.ReadFile(f)
+	} else {
+		desc = shortRev(rev)
+		raw, err = repo.vcs.cat(repo.dir, rev, rel)
+	}
+	if err != nil {
+		return srcBlob{}, fmt.Errorf("cannot read %s at %s: %v", rel, desc, err)
+	}
+	data, _, err := vendorBytes(f, raw)
+	if err != nil {
+		return srcBlob{}, err
+	}
+	if data == nil {
+		data = []byte{} // an empty file, not a missing one
+	}
+	return srcBlob{data: data, rev: desc}, nil
+}
+
+// srcKey returns the key in a srcTree of the file f of repo.
+func srcKey(repo *repoState, f string) string {
+	rel, err := filepath.Rel(repo.dir, f)
+	if err != nil {
+		return filepath.ToSlash(f)
+	}
+	return path.Join(repo.root, filepath.ToSlash(rel))
+}
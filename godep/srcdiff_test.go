@@ -0,0 +1,132 @@
+package godep
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSrcDiff(t *testing.T) {
+	var cases = []struct {
+		pkg     string
+		revs    []string
+		want    []string // in the output, in order
+		notWant []string // not in the output
+		changed bool
+		werr    bool
+	}{
+		{ // 0 - manifest revision against GOPATH
+			pkg: "D",
+			want: []string{
+				"--- D/README@",
+				"-read me 1",
+				"+read me 2",
+				"--- D/main.go@",
+				"+++ D/main.go@GOPATH",
+				"-var D1 int",
+				"+var D2 int",
+				"--- /dev/null",
+				"+++ D/new.go@GOPATH",
+				"D: 3 files changed, +6 -2",
+			},
+			notWant: []string{"main_test.go", "D/sub", "import \"D\""},
+			changed: true,
+		},
+		{ // 1 - explicit revisions
+			pkg:     "D",
+			revs:    []string{"D1", "D2"},
+			want:    []string{"--- D/main.go@D1", "+++ D/main.go@D2", "D: 3 files changed, +6 -2"},
+			changed: true,
+		},
+		{ // 2 - the same revision
+			pkg:  "D",
+			revs: []string{"D1", "D1"},
+			want: []string{"no changes"},
+		},
+		{ // 3 - not a dependency
+			pkg:  "E",
+			werr: true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	setGlobals(true)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D") + decl("D1"), nil},
+				{"main_test.go", pkg("D") + decl("T1"), nil},
+				{"README", "read me 1", nil},
+				{"sub/sub.go", pkg("sub") + decl("S1"), nil},
+				{"+git", "D1", nil},
+				{"main.go", strings.Replace(pkg("D"), "package D", "package D // import \"D\"", 1) + decl("D2"), nil},
+				{"main_test.go", pkg("D") + decl("T2"), nil},
+				{"new.go", pkg("D"), nil},
+				{"README", "read me 2", nil},
+				{"sub/sub.go", pkg("sub") + decl("S2"), nil},
+				{"+git", "D2", nil},
+			},
+		},
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main", "D"), nil},
+				{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+				{"+git", "", nil},
+			},
+		},
+	}}, "")
+	err = os.Chdir(filepath.Join(wd, src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	setGOPATH(filepath.Join(wd, gopath))
+
+	for pos, test := range cases {
+		clearPkgCache()
+		clearStatCache()
+		var buf bytes.Buffer
+		log.SetOutput(ioutil.Discard)
+		changed, err := srcDiff(&buf, test.pkg, test.revs)
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d srcDiff err = %v want %v", pos, err, test.werr)
+		}
+		if changed != test.changed {
+			t.Errorf("%d changed = %v want %v", pos, changed, test.changed)
+		}
+		out := buf.String()
+		rest := out
+		for _, s := range test.want {
+			i := strings.Index(rest, s)
+			if i < 0 {
+				t.Errorf("%d output lacks %q in order:\n%s", pos, s, out)
+				break
+			}
+			rest = rest[i+len(s):]
+		}
+		for _, s := range test.notWant {
+			if strings.Contains(out, s) {
+				t.Errorf("%d output has %q:\n%s", pos, s, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package godep
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// journalFile records a vendor transaction in progress, so a run that
+// dies part way can be rolled back by the next one.
+var journalFile = filepath.Join("Godeps", ".journal")
+
+// Transaction phases, as recorded in the journal.
+const (
+	txnStaging  = "staging"  // only the stage and new manifest were written
+	txnSwapping = "swapping" // renames into place have begun
+	txnDone     = "done"     // everything is in place; leftovers remain
+)
+
+// vendorTxn stages a change to the vendored source and the manifest,
+// then swaps both into place with renames. The live source directory
+// is mirrored in Stage with hard links, changed there, and renamed over
+// Dir only once everything has succeeded; the old tree is kept in Backup until the
+// new manifest is in place too.
+type vendorTxn struct {
+	Op          string // command that began the transaction
+	Dir         string // live source directory, e.g. vendor
+	Stage       string // where the new source tree is built
+	Backup      string // where the old source tree is kept during the swap
+	Manifest    string // the Godeps file
+	HadDir      bool   // whether Dir existed when the transaction began
+	HadManifest bool   // whether Manifest existed when the transaction began
+	Phase       string
+
+	mu  sync.Mutex
+	tmp string // temporary directory holding the stage of a dry run
+}
+
+// activeTxn is the transaction in progress, if any, for the signal
+// handler installed by Command.Exec to roll back.
+var (
+	activeMu  sync.Mutex
+	activeTxn *vendorTxn
+)
+
+// beginTxn starts a transaction that will replace dir and manifest.
+// Changes to the source tree must be made under the returned Stage.
+func beginTxn(op, dir, manifest string) (*vendorTxn, error) {
+	dir = filepath.Clean(dir)
+	t := &vendorTxn{
+		Op:       op,
+		Dir:      dir,
+		Stage:    filepath.Join(filepath.Dir(dir), ".godep-stage"),
+		Backup:   filepath.Join(filepath.Dir(dir), ".godep-backup"),
+		Manifest: manifest,
+		Phase:    txnStaging,
+	}
+	// A Backup left by an earlier run must go before the journal
+	// names it, or rolling back would take it for this one's.
+	for _, name := range []string{t.Stage, t.Backup} {
+		if err := os.RemoveAll(name); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.writeJournal(); err != nil {
+		return nil, err
+	}
+	t.activate()
+	if err := t.stage(); err != nil {
+		t.abort()
+		return nil, err
+	}
+	if err := t.writeJournal(); err != nil {
+		t.abort()
+		return nil, err
+	}
+	return t, nil
+}
+
+// startTxn is beginTxn, or planTxn in a dry run.
+func startTxn(op, dir, manifest string) (*vendorTxn, error) {
+	if planning != nil {
+		return planTxn(op, dir, manifest)
+	}
+	return beginTxn(op, dir, manifest)
+}
+
+// planTxn is beginTxn for a dry run. The stage is built in a temporary
+// directory and nothing is written next to dir; the transaction can
+// only be aborted.
+func planTxn(op, dir, manifest string) (*vendorTxn, error) {
+	tmp, err := ioutil.TempDir("", "godep-plan")
+	if err != nil {
+		return nil, err
+	}
+	t := &vendorTxn{
+		Op:       op,
+		Dir:      filepath.Clean(dir),
+		Stage:    filepath.Join(tmp, "stage"),
+		Manifest: manifest,
+		Phase:    txnStaging,
+		tmp:      tmp,
+	}
+	if err := t.stage(); err != nil {
+		t.abort()
+		return nil, err
+	}
+	return t, nil
+}
+
+// stage fills the stage with the current source tree.
+func (t *vendorTxn) stage() error {
+	if _, err := os.Lstat(t.Manifest); err == nil {
+		t.HadManifest = true
+	}
+	if fi, err := os.Stat(t.Dir); err == nil && fi.IsDir() {
+		t.HadDir = true
+		verboseln("Staging", t.Dir, "in", t.Stage)
+		return linkTree(t.Stage, t.Dir)
+	}
+	return os.MkdirAll(t.Stage, 0777)
+}
+
+// commit writes g as the new manifest and swaps the staged tree and
+// manifest into place. If any step fails, everything is rolled back.
+func (t *vendorTxn) commit(g *Godeps) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.commitLocked(g); err != nil {
+		t.rollback()
+		t.deactivate()
+		return err
+	}
+	t.cleanup()
+	t.deactivate()
+	clearStatCache()
+	return nil
+}
+
+func (t *vendorTxn) commitLocked(g *Godeps) error {
+	f, err := os.Create(t.Manifest + ".new")
+	if err != nil {
+		return err
+	}
+	_, err = g.writeTo(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if t.HadManifest {
+		if err := copyPlainFile(t.Manifest+".old", t.Manifest); err != nil {
+			return err
+		}
+	}
+
+	t.Phase = txnSwapping
+	if err := t.writeJournal(); err != nil {
+		return err
+	}
+	if t.HadDir {
+		if err := os.Rename(t.Dir, t.Backup); err != nil {
+			return err
+		}
+	} else if err := os.MkdirAll(filepath.Dir(t.Dir), 0777); err != nil {
+		return err
+	}
+	if err := os.Rename(t.Stage, t.Dir); err != nil {
+		return err
+	}
+	if err := os.Rename(t.Manifest+".new", t.Manifest); err != nil {
+		return err
+	}
+
+	t.Phase = txnDone
+	return t.writeJournal()
+}
+
+// abort rolls back a transaction that has not been committed.
+func (t *vendorTxn) abort() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Phase == "" {
+		return // committed or already rolled back
+	}
+	if t.tmp != "" {
+		logErr(os.RemoveAll(t.tmp))
+		t.Phase = ""
+		return
+	}
+	t.rollback()
+	t.deactivate()
+}
+
+// rollback undoes whatever the transaction did, judged by its phase and
+// by which of the renames have happened. A transaction that reached
+// txnDone is finished instead. The caller must hold t.mu, unless t came
+// from the journal of an earlier run.
+func (t *vendorTxn) rollback() {
+	switch t.Phase {
+	case txnStaging:
+		logErr(os.RemoveAll(t.Stage))
+		logErr(removeIfExists(t.Manifest + ".new"))
+		logErr(removeIfExists(t.Manifest + ".old"))
+	case txnSwapping:
+		if _, err := os.Lstat(t.Backup); err == nil {
+			// Dir is the new tree, or missing.
+			logErr(os.RemoveAll(t.Dir))
+			logErr(os.Rename(t.Backup, t.Dir))
+		} else if _, err := os.Lstat(t.Stage); !t.HadDir && os.IsNotExist(err) {
+			// The stage was renamed into a Dir that did not exist.
+			logErr(os.RemoveAll(t.Dir))
+		}
+		logErr(os.RemoveAll(t.Stage))
+		if t.HadManifest {
+			logErr(os.Rename(t.Manifest+".old", t.Manifest))
+		} else {
+			logErr(removeIfExists(t.Manifest))
+		}
+		logErr(removeIfExists(t.Manifest + ".new"))
+	case txnDone:
+		t.cleanup()
+		return
+	}
+	removeJournal()
+	t.Phase = ""
+}
+
+// cleanup removes what a finished transaction leaves behind.
+func (t *vendorTxn) cleanup() {
+	logErr(os.RemoveAll(t.Backup))
+	logErr(removeIfExists(t.Manifest + ".old"))
+	removeJournal()
+	t.Phase = ""
+}
+
+// removeJournal removes the journal, and the Godeps directory too if
+// the journal was all that was in it.
+func removeJournal() {
+	name := inProject(journalFile)
+	logErr(removeIfExists(name))
+	os.Remove(filepath.Dir(name)) // only succeeds if empty
+}
+
+func (t *vendorTxn) writeJournal() error {
+	b, err := json.MarshalIndent(t, "", "\t")
+	if err != nil {
+		return err
+	}
+	name := inProject(journalFile)
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// activate makes t the transaction the signal handler rolls back.
+func (t *vendorTxn) activate() {
+	activeMu.Lock()
+	activeTxn = t
+	activeMu.Unlock()
+}
+
+func (t *vendorTxn) deactivate() {
+	activeMu.Lock()
+	if activeTxn == t {
+		activeTxn = nil
+	}
+	activeMu.Unlock()
+}
+
+// handleSignals rolls back the transaction in progress, if any, and
+// fails with errorInterrupted if godep is interrupted, so that -json
+// still ends with an error event and the summary. The returned func
+// stops it.
+func handleSignals() (stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-c; !ok {
+			return
+		}
+		activeMu.Lock()
+		t := activeTxn
+		activeMu.Unlock()
+		if t != nil {
+			t.mu.Lock() // held until exit, so nothing else runs
+			if t.Phase != "" {
+				log.Printf("interrupted, rolling back %s\n", t.Op)
+				t.rollback()
+			}
+		}
+		fatal(errorInterrupted)
+	}()
+	return func() {
+		signal.Stop(c)
+		close(c)
+	}
+}
+
+// recoverTxn rolls back a transaction left behind by an interrupted run,
+// or finishes one that got as far as txnDone. A dry run changes
+// nothing, so it fails instead.
+func recoverTxn() error {
+	b, err := ioutil.ReadFile(inProject(journalFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if planning != nil {
+		return errorTxnPending
+	}
+	var t vendorTxn
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+	// A journal written by the godep command has paths relative to
+	// the project.
+	t.Dir, t.Stage, t.Backup = inProject(t.Dir), inProject(t.Stage), inProject(t.Backup)
+	t.Manifest = inProject(t.Manifest)
+	if t.Phase == txnDone {
+		verboseln("Cleaning up after", t.Op)
+	} else {
+		log.Printf("rolling back interrupted %s\n", t.Op)
+	}
+	t.rollback()
+	clearStatCache()
+	return nil
+}
+
+// linkTree recreates the directories and symlinks under src in dst,
+// and hard links its regular files there, copying those that cannot be
+// linked. Everything that changes the stage replaces files rather than
+// writing through them, so the links leave src untouched.
+func linkTree(dst, src string) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, fi.Mode().Perm()|0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		if err := os.Link(path, target); err == nil {
+			return nil
+		}
+		if err := copyPlainFile(target, path); err != nil {
+			return err
+		}
+		// Keep the time, so files copySrc leaves alone look untouched.
+		return os.Chtimes(target, fi.ModTime(), fi.ModTime())
+	})
+}
+
+// copyPlainFile copies src to dst byte for byte, keeping its mode.
+func copyPlainFile(dst, src string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	fi, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func removeIfExists(name string) error {
+	err := os.Remove(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func logErr(err error) {
+	if err != nil {
+		log.Println(err)
+	}
+}
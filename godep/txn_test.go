@@ -0,0 +1,199 @@
+package godep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// txnTest sets up a project in a temporary directory and changes into
+// it. The returned function changes back and removes it.
+func txnTest(t *testing.T, vendor bool) func() {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "godep-txn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(godepsFile, "old\n")
+	if vendor {
+		writeFile(filepath.Join("vendor", "D", "d.go"), "package D\n")
+	}
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func checkTxnFiles(t *testing.T, pos int, want map[string]string) {
+	for name, body := range want {
+		b, err := ioutil.ReadFile(name)
+		switch {
+		case body == "(absent)":
+			if !os.IsNotExist(err) {
+				t.Errorf("%d %s exists, want absent", pos, name)
+			}
+		case err != nil:
+			t.Errorf("%d %v", pos, err)
+		case string(b) != body:
+			t.Errorf("%d %s = %q want %q", pos, name, b, body)
+		}
+	}
+	for _, name := range []string{journalFile, ".godep-stage", ".godep-backup", godepsFile + ".new", godepsFile + ".old"} {
+		if _, err := os.Lstat(name); !os.IsNotExist(err) {
+			t.Errorf("%d %s left behind", pos, name)
+		}
+	}
+}
+
+func stageChange(t *testing.T, txn *vendorTxn) {
+	if err := os.RemoveAll(filepath.Join(txn.Stage, "D")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(txn.Stage, "E", "e.go"), "package E\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var (
+	txnOld = map[string]string{
+		godepsFile:                           "old\n",
+		filepath.Join("vendor", "D", "d.go"): "package D\n",
+		filepath.Join("vendor", "E", "e.go"): "(absent)",
+	}
+	txnNew = map[string]string{
+		filepath.Join("vendor", "D", "d.go"): "(absent)",
+		filepath.Join("vendor", "E", "e.go"): "package E\n",
+	}
+)
+
+func TestTxnCommitAndAbort(t *testing.T) {
+	for pos, vendor := range []bool{true, false} {
+		func() {
+			defer txnTest(t, vendor)()
+			txn, err := beginTxn("test", "vendor", godepsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stageChange(t, txn)
+			txn.abort()
+			want := txnOld
+			if !vendor {
+				want = map[string]string{godepsFile: "old\n", "vendor": "(absent)"}
+			}
+			checkTxnFiles(t, pos, want)
+
+			txn, err = beginTxn("test", "vendor", godepsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stageChange(t, txn)
+			if err := txn.commit(&Godeps{ImportPath: "C"}); err != nil {
+				t.Fatal(err)
+			}
+			txn.abort() // no-op once committed
+			checkTxnFiles(t, pos, txnNew)
+			if b, _ := ioutil.ReadFile(godepsFile); len(b) == 0 || string(b) == "old\n" {
+				t.Errorf("%d manifest not replaced: %q", pos, b)
+			}
+		}()
+	}
+}
+
+// TestTxnRecover interrupts a transaction after each step of the swap
+// and checks the next run puts things back.
+func TestTxnRecover(t *testing.T) {
+	steps := []func(txn *vendorTxn) error{
+		func(txn *vendorTxn) error { return os.Rename(txn.Dir, txn.Backup) },
+		func(txn *vendorTxn) error { return os.Rename(txn.Stage, txn.Dir) },
+		func(txn *vendorTxn) error { return os.Rename(txn.Manifest+".new", txn.Manifest) },
+	}
+	for n := 0; n <= len(steps); n++ {
+		func() {
+			defer txnTest(t, true)()
+			txn, err := beginTxn("test", "vendor", godepsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txn.deactivate() // as if the process died
+			stageChange(t, txn)
+			writeFile(godepsFile+".new", "new\n")
+			copyPlainFile(godepsFile+".old", godepsFile)
+			txn.Phase = txnSwapping
+			if err := txn.writeJournal(); err != nil {
+				t.Fatal(err)
+			}
+			for _, step := range steps[:n] {
+				if err := step(txn); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := recoverTxn(); err != nil {
+				t.Fatal(err)
+			}
+			checkTxnFiles(t, n, txnOld)
+		}()
+	}
+
+	// A transaction that got to the end is finished, not undone.
+	defer txnTest(t, true)()
+	txn, err := beginTxn("test", "vendor", godepsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.deactivate()
+	stageChange(t, txn)
+	if err := txn.commitLocked(&Godeps{ImportPath: "C"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := recoverTxn(); err != nil {
+		t.Fatal(err)
+	}
+	checkTxnFiles(t, -1, txnNew)
+}
+
+// TestTxnStageLinks checks that replacing a staged file, as copySrc
+// does, leaves the live file it is linked to alone.
+func TestTxnStageLinks(t *testing.T) {
+	defer txnTest(t, true)()
+	txn, err := beginTxn("test", "vendor", godepsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txn.abort()
+	staged := filepath.Join(txn.Stage, "D", "d.go")
+	if err := replaceFile(staged, 0666, []byte("package D // new\n")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		filepath.Join("vendor", "D", "d.go"): "package D\n",
+		staged:                               "package D // new\n",
+	} {
+		if b, err := ioutil.ReadFile(name); err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v want %q", name, b, err, want)
+		}
+	}
+}
+
+// TestTxnStaleBackup checks that a backup left by an earlier run is
+// never taken for the old tree.
+func TestTxnStaleBackup(t *testing.T) {
+	defer txnTest(t, true)()
+	writeFile(filepath.Join(".godep-backup", "D", "d.go"), "package D // stale\n")
+	txn, err := beginTxn("test", "vendor", godepsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(".godep-backup"); !os.IsNotExist(err) {
+		t.Error(".godep-backup kept by beginTxn")
+	}
+	stageChange(t, txn)
+	txn.abort()
+	checkTxnFiles(t, 0, txnOld)
+}
@@ -0,0 +1,143 @@
+package godep
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var cmdUnrewrite = &Command{
+	Name:  "unrewrite",
+	Args:  "[-n] [-plan-out file]",
+	Short: "migrate a rewritten Godeps workspace to vendor/",
+	Long: `
+Unrewrite migrates a project saved with 'godep save -r' from
+Godeps/_workspace to the vendor directory.
+
+It reverses the rewriting of import paths in every Go file of the
+project and of the workspace copy, so that an import of
+C/Godeps/_workspace/src/D is again an import of D. It then moves
+Godeps/_workspace/src to vendor, removes Godeps/_workspace, and runs the
+consistency checks of 'godep check' on the result, exiting with status
+1 if they find anything.
+
+Godeps.json is left as it is. Unrewrite refuses to run if vendor
+already holds anything, unless an earlier run failed after moving
+Godeps/_workspace/src there, in which case it finishes that run:
+it removes what is left of Godeps/_workspace and runs the checks.
+
+If -n is given, unrewrite prints every file it would rewrite, move or
+remove, without changing anything. The -plan-out flag is as for save,
+and the plan can be carried out with 'godep apply'.
+`,
+	Run:          runUnrewrite,
+	OnlyInGOPATH: true,
+}
+
+func init() {
+	addPlanFlags(&cmdUnrewrite.Flag)
+}
+
+func runUnrewrite(cmd *Command, args []string) {
+	if len(args) != 0 {
+		cmd.UsageExit()
+	}
+	runPlanned(cmd, args, unrewrite)
+}
+
+// unrewrite migrates the project in the current directory from a
+// rewritten Godeps workspace to vendor, as described for the command.
+// It can be run again to finish a migration that failed part way.
+func unrewrite(args []string) error {
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return err
+	}
+	ws := filepath.Join("Godeps", "_workspace")
+	src := filepath.Join(ws, "src")
+	vendor := relativeVendorTarget(true)
+	names, _ := ioutil.ReadDir(vendor)
+	if fi, err := os.Stat(src); err != nil || !fi.IsDir() {
+		if fi, err := os.Stat(ws); err != nil || !fi.IsDir() || len(names) == 0 {
+			return errorNoWorkspace
+		}
+		// An earlier run moved src but failed to remove the rest.
+		if planning != nil {
+			return planning.moved(src, vendor, ws)
+		}
+		verboseln("Removing", ws)
+		if err := os.RemoveAll(ws); err != nil {
+			return err
+		}
+		return checkMigrated(g, vendor)
+	}
+	if len(names) > 0 {
+		return errorVendorExists
+	}
+
+	// Unqualify imports whatever layout the Go version picks, as
+	// they were written for the workspace.
+	defer func(s string) { sep = s }(sep)
+	sep = defaultSep(false)
+	verboseln("Rewriting imports")
+	if err := rewriteTree(".", "", nil); err != nil {
+		return err
+	}
+
+	if planning != nil {
+		return planning.moved(src, vendor, ws)
+	}
+	verboseln("Moving", src, "to", vendor)
+	os.Remove(vendor) // empty, if present
+	if err := os.Rename(src, vendor); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(ws); err != nil {
+		return err
+	}
+	return checkMigrated(g, vendor)
+}
+
+// checkMigrated runs the checks of godep check on the project g, just
+// migrated to vendor.
+func checkMigrated(g Godeps, vendor string) error {
+	if !determineVendor(majorGoVersion) {
+		log.Printf("WARNING: %s does not use %s; set GO15VENDOREXPERIMENT=1 or use a newer Go\n", majorGoVersion, vendor)
+	}
+	vendorExperiment, sep = true, defaultSep(true)
+	clearPkgCache()
+	groups, err := check()
+	if err != nil {
+		return err
+	}
+	if len(groups) > 0 {
+		reportCheck(groups)
+		return errorCheckFailed
+	}
+	verboseln("Migrated", g.ImportPath, "to", vendor)
+	return nil
+}
+
+// moved records the files in the tree src that would be moved to dst,
+// and the files left in the tree rm that would be removed.
+func (p *Plan) moved(src, dst, rm string) error {
+	files, err := treeFiles(rm)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		name := filepath.Join(rm, filepath.FromSlash(n))
+		if hasFilePathPrefix(name, src) {
+			p.Copied = append(p.Copied, filepath.ToSlash(filepath.Join(dst, name[len(src):])))
+		}
+		p.Deleted = append(p.Deleted, filepath.ToSlash(name))
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package godep
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUnrewrite(t *testing.T) {
+	var cases = []struct {
+		plan  bool
+		start []*node
+		want  []*node
+		wplan *Plan // Rewritten, Copied and Deleted
+		werr  bool
+	}{
+		{ // 0 - rewritten workspace moved to vendor
+			start: []*node{
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{"E", "", []*node{{"main.go", pkg("E"), nil}, {"+git", "E1", nil}}},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"fmt.go", pkg("main", "fmt"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1", "E", "E1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/E"), nil},
+						{"Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+						{"Godeps/_workspace/pkg/x.a", "", nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "D"), nil},
+				{"C/fmt.go", pkg("main", "fmt"), nil},
+				{"C/vendor/D/main.go", pkg("D", "E"), nil},
+				{"C/vendor/E/main.go", pkg("E"), nil},
+				{"C/Godeps/_workspace", "(absent)", nil},
+			},
+		},
+		{ // 1 - dry run
+			plan: true,
+			start: []*node{
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+						{"Godeps/_workspace/pkg/x.a", "", nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+				{"C/vendor", "(absent)", nil},
+			},
+			wplan: &Plan{
+				Rewritten: []string{"main.go"},
+				Copied:    []string{"vendor/D/main.go"},
+				Deleted:   []string{"Godeps/_workspace/pkg/x.a", "Godeps/_workspace/src/D/main.go"},
+			},
+		},
+		{ // 2 - vendor in the way
+			start: []*node{
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+			},
+			werr: true,
+		},
+		{ // 3 - no workspace
+			start: []*node{
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D"), nil},
+			},
+			werr: true,
+		},
+		{ // 4 - finish a run that failed after the move
+			start: []*node{
+				{"D", "", []*node{{"main.go", pkg("D"), nil}, {"+git", "D1", nil}}},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/_workspace/pkg/x.a", "", nil},
+						{"vendor/D/main.go", pkg("D"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "D"), nil},
+				{"C/vendor/D/main.go", pkg("D"), nil},
+				{"C/Godeps/_workspace", "(absent)", nil},
+			},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	for pos, test := range cases {
+		setGlobals(false)
+		err = os.RemoveAll(scratch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(scratch, "r1", "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		dir := filepath.Join(wd, src, "C")
+		err = os.Chdir(dir)
+		if err != nil {
+			panic(err)
+		}
+		setGOPATH(filepath.Join(wd, scratch, "r1"))
+		var p *Plan
+		if test.plan {
+			p, err = makePlan(cmdUnrewrite, nil, unrewrite)
+		} else {
+			err = unrewrite(nil)
+		}
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d unrewrite err = %v want %v", pos, err, test.werr)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		checkTree(t, pos, &node{src, "", test.want})
+		if test.wplan != nil {
+			got := &Plan{Rewritten: p.Rewritten, Copied: p.Copied, Deleted: p.Deleted}
+			if !reflect.DeepEqual(got, test.wplan) {
+				t.Errorf("%d plan = %+v want %+v", pos, got, test.wplan)
+			}
+		}
+	}
+	setGlobals(false)
+}
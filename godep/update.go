@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"go/parser"
@@ -13,7 +13,7 @@ import (
 
 var cmdUpdate = &Command{
 	Name:  "update",
-	Args:  "[-goversion] [packages]",
+	Args:  "[-goversion] [-force] [-n] [-plan-out file] [-link hard|reflink] [-tags 'tag...'] [-ignoretags 'tag...'] [-targets 'os/arch...'] [packages]",
 	Short: "update selected packages or the go version",
 	Long: `
 Update changes the named dependency packages to use the
@@ -23,6 +23,17 @@ new revision will be written to the manifest.
 
 If -goversion is specified, update the recorded go version.
 
+Dependencies pinned with 'godep hold' are skipped, along with the
+rest of their repository, unless -force is given.
+
+Update refuses to overwrite or remove vendored files edited by hand
+(see 'godep vendor-status') unless -force is given.
+
+The -tags, -ignoretags, -targets and -link flags are as for save, and
+changes are staged, swapped into place and copied incrementally as save
+does. The -n and
+-plan-out flags are as for save too.
+
 For more about specifying packages, see 'go help packages'.
 `,
 	Run:          runUpdate,
@@ -31,26 +42,34 @@ For more about specifying packages, see 'go help packages'.
 
 var (
 	updateGoVer bool
+	updateForce bool
 )
 
 func init() {
 	cmdUpdate.Flag.BoolVar(&saveT, "t", false, "save test files during update")
 	cmdUpdate.Flag.BoolVar(&updateGoVer, "goversion", false, "update the recorded go version")
+	cmdUpdate.Flag.BoolVar(&updateForce, "force", false, "update held dependencies too, and overwrite vendored files edited by hand")
+	addBuildFlags(&cmdUpdate.Flag)
+	addCopyFlags(&cmdUpdate.Flag)
+	addPlanFlags(&cmdUpdate.Flag)
 }
 
 func runUpdate(cmd *Command, args []string) {
+	runPlanned(cmd, args, updateAll)
+}
+
+// updateAll updates the go version if -goversion was given, and the
+// packages named in args.
+func updateAll(args []string) error {
 	if updateGoVer {
-		err := updateGoVersion()
-		if err != nil {
-			log.Fatalln(err)
+		if err := updateGoVersion(); err != nil {
+			return err
 		}
 	}
 	if len(args) > 0 {
-		err := update(args)
-		if err != nil {
-			log.Fatalln(err)
-		}
+		return update(args)
 	}
+	return nil
 }
 
 func updateGoVersion() error {
@@ -67,6 +86,12 @@ func updateGoVersion() error {
 
 	gv := gold.GoVersion
 	gold.GoVersion = cv
+	if planning != nil {
+		if gv != cv {
+			planning.GoVersion = cv
+		}
+		return nil
+	}
 	_, err = gold.save()
 	if err != nil {
 		return err
@@ -83,10 +108,20 @@ func update(args []string) error {
 	if len(args) == 0 {
 		args = []string{"."}
 	}
+	if err := recoverTxn(); err != nil {
+		return err
+	}
 	g, err := loadDefaultGodepsFile()
 	if err != nil {
 		return err
 	}
+	ignoreImports = g.Ignore
+	if err := setBuildConfig(&g); err != nil {
+		return err
+	}
+	if err := checkLinkMode(); err != nil {
+		return err
+	}
 	for _, arg := range args {
 		arg := path.Clean(arg)
 		any := markMatches(arg, g.Deps)
@@ -94,24 +129,60 @@ func update(args []string) error {
 			log.Println("not in manifest:", arg)
 		}
 	}
-	deps, rdeps, err := LoadVCSAndUpdate(g.Deps)
+	rs := newRepoSession()
+	defer rs.report()
+	deps, rdeps, err := LoadVCSAndUpdate(rs, g.Deps)
 	if err != nil {
 		return err
 	}
 	if len(deps) == 0 {
 		return errorNoPackagesUpdatable
 	}
-	g.addOrUpdateDeps(deps)
-	g.removeDeps(rdeps)
-	if _, err = g.save(); err != nil {
+	if err := checkHosts(deps); err != nil {
+		return err
+	}
+	if err := checkUpdateEdits(rs, g.Deps, deps, rdeps); err != nil {
+		return err
+	}
+	// Make the changes in a copy of the source tree, swapped in
+	// only once everything has worked.
+	txn, err := startTxn("update", inProject(relativeVendorTarget(vendorExperiment)), g.file())
+	if err != nil {
+		return err
+	}
+	defer txn.abort()
+	if err := removeSrc(txn.Stage, rdeps); err != nil {
+		return err
+	}
+	if err := copySrc(rs, txn.Stage, deps); err != nil {
 		return err
 	}
+	applied, perr := applyPatches(txn.Stage, deps)
+	if perr != nil && perr != errorPatchConflicts {
+		return perr
+	}
+	setPatches(deps, applied)
 
-	srcdir := relativeVendorTarget(VendorExperiment)
-	if err := removeSrc(filepath.FromSlash(strings.Trim(sep, "/")), rdeps); err != nil {
+	old := g.copy()
+	g.addOrUpdateDeps(deps)
+	g.removeDeps(rdeps)
+	if planning != nil {
+		planning.deps(old.Deps, g.Deps)
+		err = planning.staged(txn.Dir, txn.Stage)
+	} else {
+		err = txn.commit(&g)
+	}
+	if err != nil {
 		return err
 	}
-	copySrc(srcdir, deps)
+	if planning == nil {
+		for _, d := range rdeps {
+			depResult("remove", d, nil)
+		}
+		for _, d := range deps {
+			depResult("update", d, nil)
+		}
+	}
 
 	ok, err := needRewrite(g.Packages)
 	if err != nil {
@@ -123,14 +194,17 @@ func update(args []string) error {
 			rewritePaths = append(rewritePaths, dep.ImportPath)
 		}
 	}
-	return rewrite(nil, g.ImportPath, rewritePaths)
+	if err := rewrite(nil, g.ImportPath, rewritePaths); err != nil {
+		return err
+	}
+	return perr
 }
 
 func needRewrite(importPaths []string) (bool, error) {
 	if len(importPaths) == 0 {
 		importPaths = []string{"."}
 	}
-	a, err := LoadPackages(importPaths...)
+	a, err := loadPackages(importPaths...)
 	if err != nil {
 		return false, err
 	}
@@ -165,24 +239,63 @@ func hasRewrittenImportStatement(path string) (bool, error) {
 }
 
 // markMatches marks each entry in deps with an import path that
-// matches pat. It returns whether any matches occurred.
+// matches pat. Held entries are reported and left unmarked unless
+// updateForce is set. It returns whether any matches occurred.
 func markMatches(pat string, deps []Dependency) (matched bool) {
 	f := matchPattern(pat)
 	for i, dep := range deps {
 		if f(dep.ImportPath) {
-			deps[i].matched = true
 			matched = true
+			if dep.Hold && !updateForce {
+				if dep.Reason != "" {
+					log.Printf("skipping held dependency %s (%s)\n", dep.ImportPath, dep.Reason)
+				} else {
+					log.Println("skipping held dependency", dep.ImportPath)
+				}
+				continue
+			}
+			deps[i].matched = true
 		}
 	}
 	return matched
 }
 
-func fillDeps(deps []Dependency) ([]Dependency, error) {
+// checkUpdateEdits checks, as checkVendorEdits does, that the vendored
+// copies of deps, as recorded in old, and of rdeps were not edited by
+// hand.
+func checkUpdateEdits(s *repoSession, old, deps, rdeps []Dependency) error {
+	if updateForce {
+		return nil
+	}
+	var prev []Dependency
+	for _, o := range old {
+		for _, d := range append(append([]Dependency(nil), deps...), rdeps...) {
+			if o.ImportPath == d.ImportPath {
+				prev = append(prev, o)
+				break
+			}
+		}
+	}
+	next := make(srcTree)
+	for i := range deps {
+		d := &deps[i]
+		repo, err := s.repo(d.dir, filepath.Join(d.ws, "src"))
+		if err != nil {
+			return err
+		}
+		if err := readSrcTree(next, repo, d, ""); err != nil {
+			return err
+		}
+	}
+	return checkVendorEdits(s, prev, next)
+}
+
+func fillDeps(s *repoSession, deps []Dependency) ([]Dependency, error) {
 	for i := range deps {
-		if deps[i].pkg != nil {
+		if deps[i].pkg != nil || isIgnored(deps[i].ImportPath) {
 			continue
 		}
-		ps, err := LoadPackages(deps[i].ImportPath)
+		ps, err := loadPackages(deps[i].ImportPath)
 		if err != nil {
 			if _, ok := err.(errPackageNotFound); ok {
 				deps[i].missing = true
@@ -198,28 +311,33 @@ func fillDeps(deps []Dependency) ([]Dependency, error) {
 		deps[i].dir = p.Dir
 		deps[i].ws = p.Root
 
-		vcs, reporoot, err := VCSFromDir(p.Dir, filepath.Join(p.Root, "src"))
+		repo, err := s.repo(p.Dir, filepath.Join(p.Root, "src"))
 		if err != nil {
 			return nil, errorLoadingDeps
 		}
-		deps[i].root = filepath.ToSlash(reporoot)
-		deps[i].vcs = vcs
+		deps[i].root = repo.root
+		deps[i].vcs = repo.vcs
 	}
 
 	return deps, nil
 }
 
 // LoadVCSAndUpdate loads and updates a set of dependencies.
-func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, []Dependency, error) {
+func LoadVCSAndUpdate(s *repoSession, deps []Dependency) ([]Dependency, []Dependency, error) {
 	var err1 error
 
-	deps, err := fillDeps(deps)
+	deps, err := fillDeps(s, deps)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	repoMask := make(map[string]bool)
 	for i := range deps {
+		if deps[i].matched && isIgnored(deps[i].ImportPath) {
+			verboseln("ignored, not updating:", deps[i].ImportPath)
+			deps[i].matched = false
+			continue
+		}
 		if !deps[i].matched {
 			repoMask[deps[i].root] = true
 		}
@@ -247,7 +365,7 @@ func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, []Dependency, error) {
 		}
 	}
 
-	deps, err = fillDeps(deps)
+	deps, err = fillDeps(s, deps)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -269,17 +387,23 @@ func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, []Dependency, error) {
 
 	var toCopy []Dependency
 	for _, d := range toUpdate {
-		id, err := d.vcs.identify(d.dir)
+		repo, err := s.repo(d.dir, filepath.Join(d.ws, "src"))
+		if err != nil {
+			log.Println(err)
+			err1 = errorLoadingDeps
+			continue
+		}
+		id, err := repo.identify()
 		if err != nil {
 			log.Println(err)
 			err1 = errorLoadingDeps
 			continue
 		}
-		if d.vcs.isDirty(d.dir, id) {
+		if repo.isDirty(id) {
 			log.Println("dirty working tree (please commit changes):", d.dir)
 		}
 		d.Rev = id
-		d.Comment = d.vcs.describe(d.dir, id)
+		d.Comment = repo.describe(id)
 		toCopy = append(toCopy, d)
 	}
 	debugln("toCopy")
@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"encoding/json"
@@ -19,6 +19,7 @@ func TestUpdate(t *testing.T) {
 		want   []*node
 		wdep   Godeps
 		werr   bool
+		force  bool
 	}{
 		{ // 0 - simple case, update one dependency
 			cwd:  "C",
@@ -679,6 +680,267 @@ func TestUpdate(t *testing.T) {
 				},
 			},
 		},
+		{ // 15 - local patch is reapplied after update
+			vendor: true,
+			cwd:    "C",
+			args:   []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/patches/D/0001-local.patch", patchAddDecl("D2", "P"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2") + decl("P"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D2", Patches: []string{"0001-local.patch"}},
+				},
+			},
+		},
+		{ // 16 - local patch conflicts with update
+			vendor: true,
+			cwd:    "C",
+			args:   []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/patches/D/0001-local.patch", patchAddDecl("D1", "P"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1") + decl("P"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D2"},
+				},
+			},
+			werr: true,
+		},
+		{ // 17 - held dependency is left alone
+			cwd:  "C",
+			args: []string{"..."},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", heldGodeps("C", "D", "D1", "broken upstream"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1", Hold: true, Reason: "broken upstream"},
+				},
+			},
+			werr: true,
+		},
+		{ // 18 - held dependency is updated with -force
+			cwd:   "C",
+			args:  []string{"..."},
+			force: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", heldGodeps("C", "D", "D1", "broken upstream"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D2"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D2", Hold: true, Reason: "broken upstream"},
+				},
+			},
+		},
+		{ // 19 - ignored dependency is not updated
+			cwd:  "C",
+			args: []string{"..."},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", &Godeps{
+							ImportPath: "C",
+							Ignore:     []string{"D"},
+							Deps:       []Dependency{{ImportPath: "D", Comment: "D1"}},
+						}, nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
+		{ // 20 - vendored file edited by hand is not overwritten
+			vendor: true,
+			cwd:    "C",
+			args:   []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1") + decl("Local"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D1") + decl("Local"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
+		{ // 21 - vendored file edited by hand is overwritten with -force
+			vendor: true,
+			cwd:    "C",
+			args:   []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1") + decl("Local"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D2"},
+				},
+			},
+			force: true,
+		},
 	}
 
 	wd, err := os.Getwd()
@@ -689,6 +951,7 @@ func TestUpdate(t *testing.T) {
 	defer os.RemoveAll(gopath)
 	for pos, test := range cases {
 		setGlobals(test.vendor)
+		updateForce = test.force
 		err = os.RemoveAll(gopath)
 		if err != nil {
 			t.Fatal(err)
@@ -705,6 +968,7 @@ func TestUpdate(t *testing.T) {
 		log.SetOutput(ioutil.Discard)
 		err = update(test.args)
 		log.SetOutput(os.Stderr)
+		updateForce = false
 		if err != nil {
 			t.Log(pos, "Err:", err)
 		}
@@ -740,3 +1004,10 @@ func TestUpdate(t *testing.T) {
 		}
 	}
 }
+
+func heldGodeps(importpath, dep, comment, reason string) *Godeps {
+	g := godeps(importpath, dep, comment)
+	g.Deps[0].Hold = true
+	g.Deps[0].Reason = reason
+	return g
+}
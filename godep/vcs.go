@@ -1,4 +1,4 @@
-package main
+package godep
 
 import (
 	"bytes"
@@ -22,8 +22,39 @@ type VCS struct {
 	ListCmd     string
 	RootCmd     string
 
+	// run in the repository root, with paths relative to it
+	ListRevCmd string
+	CatCmd     string
+	LogCmd     string // one line per commit after {from}, up to {to}
+	RemoteCmd  string // URL the repository fetches from
+
 	// run in sandbox repos
 	ExistsCmd string
+
+	// reader, if set, answers queries in-process instead of
+	// running the commands above.
+	reader vcsReader
+}
+
+// vcsReader answers read-only questions about a working tree
+// without running the VCS command.
+type vcsReader interface {
+	identify(dir string) (string, error)
+	root(dir string) (string, error)
+	isDirty(dir, rev string) bool
+	listFiles(dir string) vcsFiles
+	listAllFiles(root string) vcsFiles
+	exists(dir, rev string) bool
+}
+
+// useGitLib selects the built-in git implementation (gitReader)
+// for git repositories.
+func useGitLib(on bool) {
+	if on {
+		vcsGit.reader = gitReader{}
+	} else {
+		vcsGit.reader = nil
+	}
 }
 
 var vcsBzr = &VCS{
@@ -34,6 +65,11 @@ var vcsBzr = &VCS{
 	DiffCmd:     "diff -r {rev}",
 	ListCmd:     "ls --from-root -R",
 	RootCmd:     "root",
+
+	ListRevCmd: "ls --from-root -R --kind=file -r {rev}",
+	CatCmd:     "cat -r {rev} {file}",
+	LogCmd:     "log --line -r revid:{from}..revid:{to}",
+	RemoteCmd:  "config parent_location",
 }
 
 var vcsGit = &VCS{
@@ -44,6 +80,10 @@ var vcsGit = &VCS{
 	DiffCmd:     "diff {rev}",
 	ListCmd:     "ls-files --full-name",
 	RootCmd:     "rev-parse --show-cdup",
+	ListRevCmd:  "ls-tree -r --name-only --full-tree {rev}",
+	CatCmd:      "show {rev}:{file}",
+	LogCmd:      "log --oneline {from}..{to}",
+	RemoteCmd:   "remote get-url origin",
 
 	ExistsCmd: "cat-file -e {rev}",
 }
@@ -56,6 +96,10 @@ var vcsHg = &VCS{
 	DiffCmd:     "diff -r {rev}",
 	ListCmd:     "status --all --no-status",
 	RootCmd:     "root",
+	ListRevCmd:  "manifest -r {rev}",
+	CatCmd:      "cat -r {rev} {file}",
+	LogCmd:      `log -r {from}::{to}-{from} --template {node|short}:{desc|firstline}\n`,
+	RemoteCmd:   "paths default",
 
 	ExistsCmd: "cat -r {rev} .",
 }
@@ -80,6 +124,9 @@ func VCSFromDir(dir, srcRoot string) (*VCS, string, error) {
 }
 
 func (v *VCS) identify(dir string) (string, error) {
+	if v.reader != nil {
+		return v.reader.identify(dir)
+	}
 	out, err := v.runOutput(dir, v.IdentifyCmd)
 	return string(bytes.TrimSpace(out)), err
 }
@@ -92,6 +139,9 @@ func absRoot(dir, out string) string {
 }
 
 func (v *VCS) root(dir string) (string, error) {
+	if v.reader != nil {
+		return v.reader.root(dir)
+	}
 	out, err := v.runOutput(dir, v.RootCmd)
 	return absRoot(dir, string(bytes.TrimSpace(out))), err
 }
@@ -105,6 +155,9 @@ func (v *VCS) describe(dir, rev string) string {
 }
 
 func (v *VCS) isDirty(dir, rev string) bool {
+	if v.reader != nil {
+		return v.reader.isDirty(dir, rev)
+	}
 	out, err := v.runOutput(dir, v.DiffCmd, "rev", rev)
 	return err != nil || len(out) != 0
 }
@@ -140,6 +193,22 @@ func (vf vcsFiles) Contains(path string) bool {
 
 // listFiles tracked by the VCS in the repo that contains dir, converted to absolute path.
 func (v *VCS) listFiles(dir string) vcsFiles {
+	if v.reader != nil {
+		return v.reader.listFiles(dir)
+	}
+	return v.tracked(dir).inDir(dir)
+}
+
+// listAllFiles tracked by the VCS in the repo rooted at root, converted to absolute path.
+func (v *VCS) listAllFiles(root string) vcsFiles {
+	if v.reader != nil {
+		return v.reader.listAllFiles(root)
+	}
+	return v.tracked(root)
+}
+
+// tracked returns the files reported by ListCmd when run in dir.
+func (v *VCS) tracked(dir string) vcsFiles {
 	root, err := v.root(dir)
 	debugln("vcs dir", dir)
 	debugln("vcs root", root)
@@ -158,16 +227,82 @@ func (v *VCS) listFiles(dir string) vcsFiles {
 			if err != nil {
 				panic(err) // this should not happen
 			}
+			files[path] = true
+		}
+	}
+	return files
+}
 
-			if pathEqual(filepath.Dir(path), dir) {
-				files[path] = true
-			}
+// inDir returns the files in vf that are directly inside dir.
+func (vf vcsFiles) inDir(dir string) vcsFiles {
+	if vf == nil {
+		return nil
+	}
+	files := make(vcsFiles)
+	for path := range vf {
+		if pathEqual(filepath.Dir(path), dir) {
+			files[path] = true
 		}
 	}
 	return files
 }
 
+// listRev returns the files in the repository rooted at root as of
+// rev, relative to root and slash separated.
+func (v *VCS) listRev(root, rev string) ([]string, error) {
+	out, err := v.runOutput(root, v.ListRevCmd, "rev", rev)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range strings.Split(string(out), "\n") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, filepath.ToSlash(file))
+		}
+	}
+	return files, nil
+}
+
+// cat returns the contents of file, relative to the repository root
+// and slash separated, as of rev.
+func (v *VCS) cat(root, rev, file string) ([]byte, error) {
+	return v.runOutputVerboseOnly(root, v.CatCmd, "rev", rev, "file", file)
+}
+
+// log returns a line for each commit after from, up to and including
+// to, in the repository rooted at root.
+func (v *VCS) log(root, from, to string) ([]string, error) {
+	out, err := v.runOutputVerboseOnly(root, v.LogCmd, "from", from, "to", to)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, l := range strings.Split(string(out), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+// remote returns the URL the repository rooted at root fetches from,
+// with any URL rewriting configured in the VCS applied.
+func (v *VCS) remote(root string) (string, error) {
+	out, err := v.runOutputVerboseOnly(root, v.RemoteCmd)
+	if err != nil {
+		return "", err
+	}
+	u := string(bytes.TrimSpace(out))
+	if u == "" {
+		return "", errors.New("no remote")
+	}
+	return u, nil
+}
+
 func (v *VCS) exists(dir, rev string) bool {
+	if v.reader != nil {
+		return v.reader.exists(dir, rev)
+	}
 	err := v.runVerboseOnly(dir, v.ExistsCmd, "rev", rev)
 	return err == nil
 }
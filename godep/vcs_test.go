@@ -1,6 +1,12 @@
-package main
+package godep
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
 
 func TestGitDetermineDefaultBranch(t *testing.T) {
 	cases := []struct {
@@ -92,3 +98,80 @@ func TestGitDetermineDefaultBranch(t *testing.T) {
 		}
 	}
 }
+
+func TestGitReader(t *testing.T) {
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	err := os.RemoveAll(scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(wd, scratch, "src")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D") + decl("D1"), nil},
+				{"P/main.go", pkg("P"), nil},
+				{"LICENSE", license(), nil},
+				{"+git", "D1", nil},
+				{"main.go", pkg("D") + decl("D2"), nil},
+				{"link", "symlink:main.go", nil},
+				{"+git", "D2", nil},
+			},
+		},
+	}}, "")
+	repo := filepath.Join(src, "D")
+	dirs := []string{repo, filepath.Join(repo, "P")}
+
+	compare := func(step string) {
+		gitRepos = make(map[string]*gitRepo)
+		lib := gitReader{}
+		for _, dir := range dirs {
+			wid, werr := vcsGit.identify(dir)
+			id, err := lib.identify(dir)
+			if id != wid || (err != nil) != (werr != nil) {
+				t.Errorf("%s: identify(%s) = %q, %v want %q, %v", step, dir, id, err, wid, werr)
+			}
+			wroot, _ := vcsGit.root(dir)
+			root, _ := lib.root(dir)
+			if !pathEqual(root, wroot) {
+				t.Errorf("%s: root(%s) = %q want %q", step, dir, root, wroot)
+			}
+			wfiles := vcsGit.listFiles(dir)
+			files := lib.listFiles(dir)
+			if !reflect.DeepEqual(files, wfiles) {
+				t.Errorf("%s: listFiles(%s) = %v want %v", step, dir, files, wfiles)
+			}
+			for _, rev := range []string{wid, "D1", "D2", "HEAD"} {
+				if g, w := lib.isDirty(dir, rev), vcsGit.isDirty(dir, rev); g != w {
+					t.Errorf("%s: isDirty(%s, %s) = %v want %v", step, dir, rev, g, w)
+				}
+			}
+			for _, rev := range []string{wid, "D1", "D2", "HEAD", wid[:7], "0000000000000000000000000000000000000000"} {
+				if g, w := lib.exists(dir, rev), vcsGit.exists(dir, rev); g != w {
+					t.Errorf("%s: exists(%s, %s) = %v want %v", step, dir, rev, g, w)
+				}
+			}
+		}
+	}
+
+	compare("loose")
+	run(t, repo, "git", "gc", "-q")
+	compare("packed")
+	ioutil.WriteFile(filepath.Join(repo, "untracked.go"), []byte(pkg("D")), 0666)
+	compare("untracked")
+	ioutil.WriteFile(filepath.Join(repo, "main.go"), []byte(pkg("D")+decl("D3")), 0666)
+	compare("modified")
+	run(t, repo, "git", "add", "-A", ".")
+	compare("staged")
+	run(t, repo, "git", "commit", "-q", "-m", "D3")
+	compare("committed")
+	os.Remove(filepath.Join(repo, "P", "main.go"))
+	compare("deleted")
+}
@@ -0,0 +1,451 @@
+package godep
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var cmdVendorStatus = &Command{
+	Name:  "vendor-status",
+	Args:  "[-diff] [packages]",
+	Short: "list files edited in the vendored copy of dependencies",
+	Long: `
+Vendor-status compares the vendored copy of each dependency with the
+files save would copy from the revision recorded in Godeps.json, read
+through the VCS from the dependency's repository in GOPATH, with any
+local patches applied. It lists, for each repository, the files that
+were modified (M), added (A) or deleted (D) by hand.
+
+If packages are given, only the repositories holding them are checked.
+
+If -diff is given, the changes are also shown in a unified diff format.
+
+Save and update refuse to overwrite or remove vendored files modified
+by hand unless -force is given. Use 'godep patch create' to keep such
+changes as a local patch.
+
+Vendor-status exits with status 1 if any file was modified, added or
+deleted.
+`,
+	Run:          runVendorStatus,
+	OnlyInGOPATH: true,
+}
+
+var vendorStatusDiff bool
+
+func init() {
+	cmdVendorStatus.Flag.BoolVar(&vendorStatusDiff, "diff", false, "show the changes as a unified diff")
+}
+
+// VendorStatus is how the vendored copy of a repository differs from
+// its recorded revision. File names are import path style, as D/d.go.
+type VendorStatus struct {
+	Root     string
+	Rev      string
+	Modified []string `json:",omitempty"`
+	Added    []string `json:",omitempty"`
+	Deleted  []string `json:",omitempty"`
+	Err      string   `json:",omitempty"` // why the copy could not be checked
+
+	want, have map[string][]byte // contents of the files listed
+}
+
+func (vs *VendorStatus) changed() bool {
+	return len(vs.Modified)+len(vs.Added)+len(vs.Deleted) > 0
+}
+
+func runVendorStatus(cmd *Command, args []string) {
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		fatal(err)
+	}
+	ignoreImports = g.Ignore
+	if err := setBuildConfig(&g); err != nil {
+		fatal(err)
+	}
+	deps := g.Deps
+	if len(args) > 0 {
+		deps = nil
+		for _, d := range g.Deps {
+			for _, a := range args {
+				a = path.Clean(a)
+				if containsPathPrefix([]string{a}, d.ImportPath) || containsPathPrefix([]string{d.ImportPath}, a) {
+					deps = append(deps, d)
+					break
+				}
+			}
+		}
+		if len(deps) == 0 {
+			fatal(errNoSuchDep(strings.Join(args, " ")))
+		}
+	}
+	sts, err := vendorStatus(newRepoSession(), deps, nil)
+	if err != nil {
+		fatal(err)
+	}
+	var changed bool
+	for _, vs := range sts {
+		if events != nil {
+			result("status", vs.Root, vs.Rev, vs)
+		} else {
+			vs.writeText(stdout, vendorStatusDiff)
+		}
+		changed = changed || vs.changed()
+	}
+	if changed {
+		exit(1)
+	}
+}
+
+func (vs *VendorStatus) writeText(w io.Writer, diff bool) {
+	if vs.Err != "" {
+		fmt.Fprintf(w, "%s: %s\n", vs.Root, vs.Err)
+		return
+	}
+	if !vs.changed() {
+		verboseln(vs.Root, "unmodified at", shortRev(vs.Rev))
+		return
+	}
+	fmt.Fprintf(w, "%s (%s):\n", vs.Root, shortRev(vs.Rev))
+	for _, l := range []struct {
+		op    string
+		files []string
+	}{{"M", vs.Modified}, {"A", vs.Added}, {"D", vs.Deleted}} {
+		for _, f := range l.files {
+			fmt.Fprintf(w, "\t%s %s\n", l.op, f)
+		}
+	}
+	if !diff {
+		return
+	}
+	var names []string
+	names = append(names, vs.Modified...)
+	names = append(names, vs.Added...)
+	names = append(names, vs.Deleted...)
+	sort.Strings(names)
+	vendor := filepath.ToSlash(relativeVendorTarget(vendorExperiment))
+	for _, n := range names {
+		from, to := n+"@"+shortRev(vs.Rev), path.Join(vendor, n)
+		want, ok := vs.want[n]
+		if !ok {
+			from = "/dev/null"
+		}
+		have, ok := vs.have[n]
+		if !ok {
+			to = "/dev/null"
+		}
+		writeDiff(w, from, to, want, have)
+	}
+}
+
+// vendorStatus compares the vendored copy of the repositories holding
+// deps with their recorded revisions. If same is not nil, vendored
+// files it reports as the same as name's new contents are not read at
+// the revision, and taken as unchanged.
+func vendorStatus(s *repoSession, deps []Dependency, same func(name string, data []byte) bool) ([]*VendorStatus, error) {
+	deps = append([]Dependency(nil), deps...)
+	deps, err := fillDeps(s, deps)
+	if err != nil {
+		return nil, err
+	}
+	var sts []*VendorStatus
+	byRoot := make(map[string]*VendorStatus)
+	repos := make(map[string][]Dependency)
+	for _, d := range deps {
+		if isIgnored(d.ImportPath) {
+			continue
+		}
+		if d.missing {
+			sts = append(sts, &VendorStatus{Root: d.ImportPath, Rev: d.Rev, Err: "not in GOPATH; cannot read its revision"})
+			continue
+		}
+		if byRoot[d.root] == nil {
+			byRoot[d.root] = &VendorStatus{Root: d.root, Rev: d.Rev}
+			sts = append(sts, byRoot[d.root])
+		}
+		repos[d.root] = append(repos[d.root], d)
+	}
+	for _, vs := range sts {
+		if vs.Err == "" {
+			if err := vs.check(s, repos[vs.Root], same); err != nil {
+				vs.Err = err.Error()
+			}
+		}
+	}
+	sort.Sort(byStatusRoot(sts))
+	return sts, nil
+}
+
+// check fills in vs for the packages deps of one repository.
+func (vs *VendorStatus) check(s *repoSession, deps []Dependency, same func(string, []byte) bool) error {
+	repo, err := s.repo(deps[0].dir, filepath.Join(deps[0].ws, "src"))
+	if err != nil {
+		return err
+	}
+	for _, d := range deps[1:] {
+		if d.Rev != vs.Rev {
+			return fmt.Errorf("packages are at different revisions, %s and %s", shortRev(vs.Rev), shortRev(d.Rev))
+		}
+	}
+	// What should be there: the files at the revision, patched.
+	want := make(map[string]string) // name => file in GOPATH
+	for i := range deps {
+		files, err := vendoredFiles(repo, &deps[i], vs.Rev)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			want[srcKey(repo, f)] = f
+		}
+	}
+	names, err := patchesFor(vs.Root)
+	if err != nil {
+		return err
+	}
+	patches, err := loadPatches(vs.Root, names)
+	if err != nil {
+		return err
+	}
+	for name := range patches {
+		if _, ok := want[name]; !ok {
+			want[name] = "" // created by a patch
+		}
+	}
+
+	// What is there: the files in the packages' directories, and in any
+	// other directory that should hold files. Subdirectories holding
+	// other packages are left to those packages.
+	dirs := make(map[string]bool)
+	for _, d := range deps {
+		dirs[d.ImportPath] = true
+	}
+	for name := range want {
+		dirs[path.Dir(name)] = true
+	}
+	vendor := inProject(relativeVendorTarget(vendorExperiment))
+	have := make(map[string]bool)
+	for _, d := range deps {
+		dir := filepath.Join(vendor, filepath.FromSlash(d.ImportPath))
+		err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == dir {
+					return nil
+				}
+				return err
+			}
+			rel, err := filepath.Rel(vendor, p)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if fi.IsDir() {
+				if p != dir && !containsPathPrefix([]string{vs.Root}, name) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if dirs[path.Dir(name)] {
+				have[name] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for name := range want {
+		if _, err := os.Lstat(filepath.Join(vendor, filepath.FromSlash(name))); err == nil {
+			have[name] = true
+		}
+	}
+
+	vs.want, vs.have = make(map[string][]byte), make(map[string][]byte)
+	for name := range have {
+		data, err := ioutil.ReadFile(filepath.Join(vendor, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if same != nil && same(name, data) {
+			continue
+		}
+		f, ok := want[name]
+		if !ok {
+			vs.Added = append(vs.Added, name)
+			vs.have[name] = data
+			continue
+		}
+		w, ok, err := wantFile(repo, vs.Rev, f, patches[name])
+		if err != nil {
+			return err
+		}
+		switch {
+		case !ok:
+			vs.Added = append(vs.Added, name)
+			vs.have[name] = data
+		case !bytes.Equal(w, data) && !sameGoSource(name, w, data):
+			vs.Modified = append(vs.Modified, name)
+			vs.want[name], vs.have[name] = w, data
+		}
+	}
+	for name, f := range want {
+		if have[name] {
+			continue
+		}
+		w, ok, err := wantFile(repo, vs.Rev, f, patches[name])
+		if err != nil {
+			return err
+		}
+		if ok {
+			vs.Deleted = append(vs.Deleted, name)
+			vs.want[name] = w
+		}
+	}
+	sort.Strings(vs.Modified)
+	sort.Strings(vs.Added)
+	sort.Strings(vs.Deleted)
+	return nil
+}
+
+// wantFile returns the vendored contents of the file f of repo as of
+// rev, with the patches fps applied, and whether the file exists at all.
+// If f is "", the file is created by the patches.
+func wantFile(repo *repoState, rev, f string, fps []filePatch) ([]byte, bool, error) {
+	var data []byte
+	exists := f != ""
+	if exists {
+		b, err := readSrcFile(repo, rev, f)
+		if err != nil {
+			return nil, false, err
+		}
+		data = b.data
+	}
+	for _, fp := range fps {
+		b, err := fp.apply(data, exists)
+		if err != nil {
+			debugln("patch does not apply to", f+":", err)
+			continue
+		}
+		data, exists = b, fp.newName != ""
+	}
+	return data, exists, nil
+}
+
+// sameGoSource reports whether a and b are the same Go source file
+// once formatted, with any import paths rewritten by save -r restored.
+func sameGoSource(name string, a, b []byte) bool {
+	if !strings.HasSuffix(name, ".go") {
+		return false
+	}
+	ua, err := unrewriteSource(name, a)
+	if err != nil {
+		return false
+	}
+	ub, err := unrewriteSource(name, b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ua, ub)
+}
+
+// unrewriteSource returns the Go source src, formatted, with import
+// paths into the Godeps workspace unqualified.
+func unrewriteSource(name string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range f.Imports {
+		p, err := strconv.Unquote(s.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		s.Path.Value = strconv.Quote(unqualify(p))
+	}
+	ast.SortImports(fset, f)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// loadPatches returns the changes the named local patches of the
+// repository root make to each file, in order, keyed by import path
+// style file name.
+func loadPatches(root string, names []string) (map[string][]filePatch, error) {
+	patches := make(map[string][]filePatch)
+	for _, n := range names {
+		data, err := ioutil.ReadFile(inProject(filepath.Join(patchDir, filepath.FromSlash(root), n)))
+		if err != nil {
+			return nil, err
+		}
+		fps, err := parsePatch(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", n, err)
+		}
+		for _, fp := range fps {
+			name := fp.newName
+			if name == "" {
+				name = fp.oldName
+			}
+			name = path.Join(root, name)
+			patches[name] = append(patches[name], fp)
+		}
+	}
+	return patches, nil
+}
+
+// checkVendorEdits returns an error listing the files of the vendored
+// copies of old, the dependencies as recorded before a save or update,
+// that were edited by hand and would be overwritten or removed, unless
+// updateForce is set. A file whose vendored contents are the same as in
+// next, the files about to be copied, is not overwritten.
+func checkVendorEdits(s *repoSession, old []Dependency, next srcTree) error {
+	if updateForce || len(old) == 0 {
+		return nil
+	}
+	var same func(string, []byte) bool
+	if next != nil {
+		same = func(name string, data []byte) bool {
+			b, ok := next[name]
+			return ok && bytes.Equal(b.data, data)
+		}
+	}
+	sts, err := vendorStatus(s, old, same)
+	if err != nil {
+		return err
+	}
+	var edited []string
+	for _, vs := range sts {
+		if vs.Err != "" {
+			verboseln("cannot check", vs.Root, "for edits:", vs.Err)
+			continue
+		}
+		edited = append(edited, vs.Modified...)
+		edited = append(edited, vs.Added...)
+	}
+	if len(edited) > 0 {
+		return errVendorEdited(edited)
+	}
+	return nil
+}
+
+// byStatusRoot sorts statuses by repository root.
+type byStatusRoot []*VendorStatus
+
+func (a byStatusRoot) Len() int           { return len(a) }
+func (a byStatusRoot) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byStatusRoot) Less(i, j int) bool { return a[i].Root < a[j].Root }
@@ -0,0 +1,182 @@
+package godep
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVendorStatus(t *testing.T) {
+	var cases = []struct {
+		vendor bool
+		start  []*node
+		want   []VendorStatus // Rev ignored
+	}{
+		{ // 0 - unmodified
+			vendor: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []VendorStatus{{Root: "D"}},
+		},
+		{ // 1 - modified, added and deleted
+			vendor: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"d.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("Local"), nil},
+						{"vendor/D/local.go", pkg("D"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []VendorStatus{{
+				Root:     "D",
+				Modified: []string{"D/main.go"},
+				Added:    []string{"D/local.go"},
+				Deleted:  []string{"D/d.go"},
+			}},
+		},
+		{ // 2 - local patch applied
+			vendor: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/patches/D/0001-local.patch", patchAddDecl("D1", "P"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1") + decl("P"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []VendorStatus{{Root: "D"}},
+		},
+		{ // 3 - rewritten imports in the Godeps workspace
+			start: []*node{
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "E"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1", "E", "E1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/E"), nil},
+						{"Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []VendorStatus{{Root: "D"}, {Root: "E"}},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		setGlobals(test.vendor)
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		setGOPATH(filepath.Join(wd, gopath))
+		g, err := loadDefaultGodepsFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		sts, err := vendorStatus(newRepoSession(), g.Deps, nil)
+		log.SetOutput(os.Stderr)
+		if err != nil {
+			t.Errorf("%d vendorStatus: %v", pos, err)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		var got []VendorStatus
+		for _, vs := range sts {
+			got = append(got, VendorStatus{
+				Root:     vs.Root,
+				Modified: vs.Modified,
+				Added:    vs.Added,
+				Deleted:  vs.Deleted,
+				Err:      vs.Err,
+			})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d status = %+v want %+v", pos, got, test.want)
+		}
+	}
+}
@@ -1,8 +1,7 @@
-package main
+package godep
 
 import (
 	"fmt"
-	"log"
 	"runtime"
 	"strconv"
 	"strings"
@@ -25,7 +24,7 @@ func versionString() string {
 }
 
 func runVersion(cmd *Command, args []string) {
-	fmt.Printf("%s\n", versionString())
+	fmt.Fprintf(stdout, "%s\n", versionString())
 }
 
 func GoVersionFields(c rune) bool {
@@ -35,6 +34,7 @@ func GoVersionFields(c rune) bool {
 // isSameOrNewer go version (goA.B)
 // go1.6 >= go1.6 == true
 // go1.5 >= go1.6 == false
+// Versions that cannot be parsed are never the same or newer.
 func isSameOrNewer(base, check string) bool {
 	if base == check {
 		return true
@@ -45,17 +45,16 @@ func isSameOrNewer(base, check string) bool {
 	bp := strings.FieldsFunc(base, GoVersionFields)
 	cp := strings.FieldsFunc(check, GoVersionFields)
 	if len(bp) < 2 || len(cp) < 2 {
-		log.Fatalf("Error comparing %s to %s\n", base, check)
+		return false // not versions we can compare
 	}
 	if bp[0] == cp[0] { // We only have go version 1 right now
 		bm, err := strconv.Atoi(bp[1])
-		// These errors are unlikely and there is nothing nice to do here anyway
 		if err != nil {
-			panic(err)
+			return false
 		}
 		cm, err := strconv.Atoi(cp[1])
 		if err != nil {
-			panic(err)
+			return false
 		}
 		return cm >= bm
 	}